@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jsgoyette/gemini"
+)
+
+// auditRequest holds the params of an order as they were submitted.
+// StopPrice is only set for stop-limit orders.
+type auditRequest struct {
+	Symbol    string   `json:"symbol"`
+	Amount    float64  `json:"amount"`
+	Price     float64  `json:"price"`
+	StopPrice float64  `json:"stop_price,omitempty"`
+	Side      string   `json:"side"`
+	Options   []string `json:"options"`
+}
+
+// auditEntry is one line of the audit log. A submit entry is written
+// before the order is sent and a response or error entry once it returns,
+// so an order interrupted mid-request still leaves a trace.
+type auditEntry struct {
+	Time          string        `json:"time"`
+	Event         string        `json:"event"`
+	Live          bool          `json:"live"`
+	ClientOrderId string        `json:"client_order_id"`
+	Request       auditRequest  `json:"request"`
+	Response      *gemini.Order `json:"response,omitempty"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// auditExchange appends every order placed through the wrapped exchange to
+// a JSON lines file, whichever command placed it.
+type auditExchange struct {
+	exchange
+	f  *os.File
+	mu sync.Mutex
+}
+
+// openAuditLog wraps ex so that orders are appended to the file at path.
+func openAuditLog(path string, ex exchange) (exchange, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ERROR_AUDIT_LOG, err)
+	}
+
+	return &auditExchange{exchange: ex, f: f}, nil
+}
+
+// NewOrder records the order around placing it, see record.
+func (a *auditExchange) NewOrder(symbol, clientOrderId string, amount, price float64, side string, options []string) (gemini.Order, error) {
+	req := auditRequest{Symbol: symbol, Amount: amount, Price: price, Side: side, Options: options}
+
+	return a.record(clientOrderId, req, func() (gemini.Order, error) {
+		return a.exchange.NewOrder(symbol, clientOrderId, amount, price, side, options)
+	})
+}
+
+// StopLimitOrder records the order around placing it, see record.
+func (a *auditExchange) StopLimitOrder(symbol, clientOrderId string, amount, stopPrice, price float64, side string) (gemini.Order, error) {
+	req := auditRequest{Symbol: symbol, Amount: amount, Price: price, StopPrice: stopPrice, Side: side}
+
+	return a.record(clientOrderId, req, func() (gemini.Order, error) {
+		return a.exchange.StopLimitOrder(symbol, clientOrderId, amount, stopPrice, price, side)
+	})
+}
+
+// record refuses to place an order that couldn't be recorded first. The
+// order has been placed by the time the response is recorded, so failing
+// to write that one is logged rather than returned.
+func (a *auditExchange) record(clientOrderId string, req auditRequest, place func() (gemini.Order, error)) (gemini.Order, error) {
+	entry := auditEntry{
+		Event:         "submit",
+		Live:          gemini_api_live,
+		ClientOrderId: clientOrderId,
+		Request:       req,
+	}
+
+	if err := a.write(entry); err != nil {
+		return gemini.Order{}, fmt.Errorf("%s: %v", ERROR_AUDIT_LOG, err)
+	}
+
+	order, err := place()
+
+	entry.Event = "response"
+	entry.Response = &order
+	if err != nil {
+		entry.Event = "error"
+		entry.Response = nil
+		entry.Error = err.Error()
+	}
+
+	if err := a.write(entry); err != nil {
+		slog.Error(ERROR_AUDIT_LOG, "error", err, "client_order_id", clientOrderId)
+	}
+
+	return order, err
+}
+
+// write appends entry as a line and syncs it to disk before returning.
+func (a *auditExchange) write(entry auditEntry) error {
+	entry.Time = time.Now().UTC().Format(time.RFC3339Nano)
+
+	chars, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.f.Write(append(chars, '\n')); err != nil {
+		return err
+	}
+
+	return a.f.Sync()
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// equityPoint is the value of the backtest's cash and position at the
+// close of a candle.
+type equityPoint struct {
+	Timestamp int64   `json:"timestamp"`
+	Close     float64 `json:"close"`
+	Position  float64 `json:"position"`
+	Equity    float64 `json:"equity"`
+}
+
+// backtestReport is the outcome of replaying a strategy over candles. A
+// round trip is a buy and the sell that closes it, and it wins when it
+// realizes more than its fees.
+type backtestReport struct {
+	Market      string        `json:"market"`
+	Interval    string        `json:"interval"`
+	Strategy    string        `json:"strategy"`
+	From        int64         `json:"from"`
+	To          int64         `json:"to"`
+	Candles     int           `json:"candles"`
+	Trades      int           `json:"trades"`
+	RoundTrips  int           `json:"round_trips"`
+	Wins        int           `json:"wins"`
+	WinRate     float64       `json:"win_rate"`
+	RealizedPnl float64       `json:"realized_pnl"`
+	Fees        float64       `json:"fees"`
+	Position    float64       `json:"position"`
+	AvgCost     float64       `json:"avg_cost"`
+	StartEquity float64       `json:"start_equity"`
+	EndEquity   float64       `json:"end_equity"`
+	ReturnPct   float64       `json:"return_pct"`
+	EquityCurve []equityPoint `json:"equity_curve"`
+}
+
+// parseSmaCross parses the fast and slow periods of --sma-cross.
+func parseSmaCross(spec string) (int, int, error) {
+	if spec == "" {
+		return 0, 0, errors.New(ERROR_NO_STRATEGY)
+	}
+
+	parts := strings.Split(spec, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("%s: %s", ERROR_INVALID_SMA, spec)
+	}
+
+	fast, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %s", ERROR_INVALID_SMA, spec)
+	}
+
+	slow, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %s", ERROR_INVALID_SMA, spec)
+	}
+
+	if fast < 1 || slow <= fast {
+		return 0, 0, fmt.Errorf("%s: %s", ERROR_INVALID_SMA, spec)
+	}
+
+	return fast, slow, nil
+}
+
+// sma returns the simple moving average of the period closes ending at i,
+// which has to be at least period-1.
+func sma(candles []candle, i, period int) float64 {
+	sum := 0.0
+	for _, c := range candles[i-period+1 : i+1] {
+		sum += c.Close
+	}
+	return sum / float64(period)
+}
+
+// backtestSmaCross replays candles, oldest first, buying with all the cash
+// at the close when the fast average crosses above the slow one and
+// selling the whole position when it crosses back below. Fills go through
+// the same FIFO ledger as pnl, with feeBps charged on each.
+func backtestSmaCross(candles []candle, fast, slow int, capital float64, feeBps int) backtestReport {
+	report := backtestReport{
+		Strategy:    fmt.Sprintf("sma-cross %d,%d", fast, slow),
+		Candles:     len(candles),
+		StartEquity: capital,
+		EquityCurve: make([]equityPoint, 0, len(candles)),
+	}
+
+	if len(candles) > 0 {
+		report.From = candles[0].Timestamp
+		report.To = candles[len(candles)-1].Timestamp
+	}
+
+	ledger := &fifoLedger{}
+	cash := capital
+	fee := float64(feeBps) / 10000
+
+	// the realized pnl and fees of the round trip that's open
+	tripStart, tripFees := 0.0, 0.0
+
+	for i, candle := range candles {
+		price := candle.Close
+
+		if i >= slow {
+			wasAbove := sma(candles, i-1, fast) > sma(candles, i-1, slow)
+			isAbove := sma(candles, i, fast) > sma(candles, i, slow)
+			position, _ := ledger.position()
+
+			switch {
+			case isAbove && !wasAbove && position == 0 && cash > 0:
+				amount := cash / (price * (1 + fee))
+				paid := amount * price * fee
+
+				ledger.buy(amount, price)
+				cash = 0
+				report.Fees += paid
+				report.Trades++
+
+				tripStart, tripFees = ledger.realized, paid
+
+			case !isAbove && wasAbove && position > 0:
+				paid := position * price * fee
+
+				ledger.sell(position, price)
+				cash += position*price - paid
+				report.Fees += paid
+				report.Trades++
+
+				report.RoundTrips++
+				if ledger.realized-tripStart > tripFees+paid {
+					report.Wins++
+				}
+			}
+		}
+
+		position, _ := ledger.position()
+		report.EquityCurve = append(report.EquityCurve, equityPoint{
+			Timestamp: candle.Timestamp,
+			Close:     price,
+			Position:  position,
+			Equity:    cash + position*price,
+		})
+	}
+
+	report.RealizedPnl = ledger.realized
+	report.Position, report.AvgCost = ledger.position()
+
+	report.EndEquity = capital
+	if n := len(report.EquityCurve); n > 0 {
+		report.EndEquity = report.EquityCurve[n-1].Equity
+	}
+
+	if report.RoundTrips > 0 {
+		report.WinRate = float64(report.Wins) / float64(report.RoundTrips) * 100
+	}
+	if capital > 0 {
+		report.ReturnPct = (report.EndEquity - capital) / capital * 100
+	}
+
+	return report
+}
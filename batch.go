@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jsgoyette/gemini"
+	"github.com/urfave/cli"
+)
+
+// orderSpec is one row of a batch file. Type defaults to limit when a
+// price is given and market otherwise.
+type orderSpec struct {
+	Market     string  `json:"mkt"`
+	Side       string  `json:"side"`
+	Amount     float64 `json:"amt"`
+	BaseAmount float64 `json:"base_amt"`
+	Price      float64 `json:"price"`
+	Type       string  `json:"type"`
+}
+
+func (s orderSpec) String() string {
+	side := strings.ToUpper(s.Side)
+
+	at := "market"
+	if s.Type == "limit" {
+		at = fmt.Sprintf("%v", s.Price)
+	}
+
+	if s.Amount > 0 {
+		return fmt.Sprintf("%s %v worth of %s @ %s", side, s.Amount, s.Market, at)
+	}
+	return fmt.Sprintf("%s %v %s @ %s", side, s.BaseAmount, s.Market, at)
+}
+
+// eachStdinSpec runs place once for every order spec read from stdin, with
+// the flags set from the spec so that each goes through the same checks as
+// flag input. Failures are reported and skipped, with a summary when there
+// was more than one spec.
+func eachStdinSpec(c *cli.Context, ex exchange, place func(c *cli.Context, ex exchange) error) error {
+	base := orderSpec{
+		Market:     getMarket(c),
+		Side:       c.String("side"),
+		Amount:     c.Float64("amt"),
+		BaseAmount: c.Float64("base-amt"),
+		Price:      c.Float64("price"),
+	}
+
+	specs, err := readStdinSpecs(os.Stdin, base)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	failed := 0
+
+	for i, spec := range specs {
+		if i > 0 && !jsonOutput(c) {
+			printSeparator()
+		}
+
+		c.Set("mkt", spec.Market)
+		c.Set("side", spec.Side)
+		c.Set("amt", strconv.FormatFloat(spec.Amount, 'f', -1, 64))
+		c.Set("base-amt", strconv.FormatFloat(spec.BaseAmount, 'f', -1, 64))
+
+		// market has no price flag
+		c.Set("price", strconv.FormatFloat(spec.Price, 'f', -1, 64))
+
+		// both print their own errors
+		err := beforeTransaction(c)
+		if err == nil {
+			err = place(c, ex)
+		}
+		if err != nil {
+			failed++
+		}
+	}
+
+	if len(specs) > 1 && !jsonOutput(c) && !quiet {
+		printSeparator()
+		fmt.Fprintf(stdout, "%s: %d, %s: %d\n", blue("Succeeded"), len(specs)-failed, blue("Failed"), failed)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d orders failed", failed, len(specs))
+	}
+
+	return nil
+}
+
+// placeOrderSpec validates spec and, unless dryRun is set, sends it through
+// the same path as the limit or market command. Limit orders are sized
+// before a dry run returns so that minimum order sizes are checked too.
+func placeOrderSpec(ex exchange, spec orderSpec, makerBps, takerBps int, dryRun bool) (*gemini.Order, error) {
+	err := validateOrderSpec(ex, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if spec.Type == "market" {
+		if dryRun {
+			return nil, nil
+		}
+
+		amount := spec.Amount
+		if spec.Side == "buy" {
+			amount -= amount * getFeeRatio(takerBps)
+		} else {
+			amount += amount * getFeeRatio(takerBps)
+		}
+
+		var placed *gemini.Order
+		err := fillMarketOrder(ex, spec.Market, spec.Side, newClientOrderId(), "immediate-or-cancel", amount, spec.BaseAmount, false, REQUOTES_MAX, nil, func(order gemini.Order) {
+			placed = &order
+		})
+		return placed, err
+	}
+
+	btcAmount, err := getLimitAmount(spec.Market, spec.Side, spec.Amount, spec.BaseAmount, spec.Price, makerBps)
+	if err != nil || dryRun {
+		return nil, err
+	}
+
+	order, err := ex.NewOrder(spec.Market, newClientOrderId(), btcAmount, spec.Price, spec.Side, []string{"maker-or-cancel"})
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// readOrderSpecs reads a batch file, as CSV with a header row when the
+// name ends in .csv and as a JSON array otherwise. Rows without a market
+// get mkt.
+func readOrderSpecs(path, mkt string) ([]orderSpec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var specs []orderSpec
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		specs, err = readOrderSpecsCSV(f)
+	} else {
+		err = json.NewDecoder(f).Decode(&specs)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range specs {
+		spec := &specs[i]
+
+		spec.Market = strings.ToLower(spec.Market)
+		spec.Side = strings.ToLower(spec.Side)
+		spec.Type = strings.ToLower(spec.Type)
+
+		if spec.Market == "" {
+			spec.Market = mkt
+		}
+
+		if spec.Type == "" {
+			spec.Type = "market"
+			if spec.Price > 0 {
+				spec.Type = "limit"
+			}
+		}
+	}
+
+	return specs, nil
+}
+
+func readOrderSpecsCSV(r io.Reader) ([]orderSpec, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		columns[strings.Replace(name, "_", "-", -1)] = i
+	}
+
+	field := func(row []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	number := func(row []string, name string) (float64, error) {
+		value := field(row, name)
+		if value == "" {
+			return 0, nil
+		}
+		return strconv.ParseFloat(value, 64)
+	}
+
+	specs := make([]orderSpec, 0, len(rows)-1)
+
+	for n, row := range rows[1:] {
+		spec := orderSpec{
+			Market: field(row, "mkt"),
+			Side:   field(row, "side"),
+			Type:   field(row, "type"),
+		}
+
+		if spec.Amount, err = number(row, "amt"); err == nil {
+			if spec.BaseAmount, err = number(row, "base-amt"); err == nil {
+				spec.Price, err = number(row, "price")
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", n+1, err)
+		}
+
+		specs = append(specs, spec)
+	}
+
+	return specs, nil
+}
+
+// readStdinSpecs reads whitespace separated JSON order specs, usually one
+// per line, each laid over base so that the flags fill in whatever a spec
+// leaves out. A spec that gives either amount replaces both.
+func readStdinSpecs(r io.Reader, base orderSpec) ([]orderSpec, error) {
+	var specs []orderSpec
+
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("spec %d: %v", n, err)
+		}
+
+		var keys map[string]json.RawMessage
+		err = json.Unmarshal(raw, &keys)
+		if err != nil {
+			return nil, fmt.Errorf("spec %d: %v", n, err)
+		}
+
+		spec := base
+		if _, ok := keys["amt"]; ok {
+			spec.BaseAmount = 0
+		}
+		if _, ok := keys["base_amt"]; ok {
+			spec.Amount = 0
+		}
+
+		err = json.Unmarshal(raw, &spec)
+		if err != nil {
+			return nil, fmt.Errorf("spec %d: %v", n, err)
+		}
+
+		spec.Market = strings.ToLower(spec.Market)
+		spec.Side = strings.ToLower(spec.Side)
+
+		specs = append(specs, spec)
+	}
+
+	return specs, nil
+}
+
+func validateOrderSpec(ex exchange, spec orderSpec) error {
+	err := validateSide(spec.Side)
+	if err != nil {
+		return err
+	}
+
+	if spec.Type != "limit" && spec.Type != "market" {
+		return fmt.Errorf("%s: %s", ERROR_INVALID_TYPE, spec.Type)
+	}
+
+	if spec.Amount > 0 && spec.BaseAmount > 0 {
+		return errors.New(ERROR_AMBIGUOUS_AMOUNT)
+	}
+
+	if spec.Amount <= 0 && spec.BaseAmount <= 0 {
+		return errors.New(ERROR_INVALID_AMOUNT)
+	}
+
+	if spec.Type == "limit" && spec.Price <= 0 {
+		return errors.New(ERROR_INVALID_PRICE)
+	}
+
+	return validateMarket(ex, spec.Market)
+}
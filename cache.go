@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// symbolCache is the file that symbols and symbol details are kept in
+// between runs. The whole file expires SYMBOL_CACHE_TTL after it was
+// first written.
+type symbolCache struct {
+	FetchedMS int64                     `json:"fetched_ms"`
+	Symbols   []string                  `json:"symbols,omitempty"`
+	Details   map[string]*symbolDetails `json:"details,omitempty"`
+}
+
+var (
+	// refreshSymbols skips the cache file so that it's rewritten from
+	// fresh responses
+	refreshSymbols bool
+
+	symbolCacheFetched int64
+	symbolCacheOnce    sync.Once
+)
+
+// symbolCachePath returns a cache file per API host, since the live and
+// sandbox exchanges list different markets. Without a cache dir or API
+// URL there is no cache.
+func symbolCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil || gemini_api_url == "" {
+		return ""
+	}
+
+	u, err := url.Parse(gemini_api_url)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	return filepath.Join(dir, "gemini-cli", "symbols-"+u.Host+".json")
+}
+
+// loadSymbolCache fills the in-memory symbol caches from the cache file
+// once per process, unless the file has expired or a refresh was asked
+// for. The cache only saves requests, so any error just leaves it empty.
+func loadSymbolCache() {
+	symbolCacheOnce.Do(func() {
+		path := symbolCachePath()
+		if refreshSymbols || path == "" {
+			return
+		}
+
+		chars, err := os.ReadFile(path)
+		if err != nil {
+			return
+		}
+
+		var cache symbolCache
+		if err := json.Unmarshal(chars, &cache); err != nil {
+			slog.Debug("Ignoring unreadable symbol cache", "path", path, "error", err)
+			return
+		}
+
+		fetched := time.Unix(0, cache.FetchedMS*int64(time.Millisecond))
+		if time.Since(fetched) > SYMBOL_CACHE_TTL {
+			slog.Debug("Symbol cache expired", "path", path, "fetched", fetched)
+			return
+		}
+
+		symbolCacheFetched = cache.FetchedMS
+		if cache.Symbols != nil {
+			symbols = cache.Symbols
+		}
+		for mkt, details := range cache.Details {
+			symbolDetailsCache[mkt] = details
+		}
+	})
+}
+
+// saveSymbolCache writes the in-memory symbol caches to the cache file,
+// through a temporary file so that a concurrent run never reads half of
+// it.
+func saveSymbolCache() {
+	path := symbolCachePath()
+	if path == "" {
+		return
+	}
+
+	if symbolCacheFetched == 0 {
+		symbolCacheFetched = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+
+	cache := symbolCache{
+		FetchedMS: symbolCacheFetched,
+		Symbols:   symbols,
+		Details:   symbolDetailsCache,
+	}
+
+	chars, err := json.Marshal(cache)
+	if err != nil {
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		slog.Debug("Failed to write symbol cache", "path", path, "error", err)
+		return
+	}
+
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, chars, 0644)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		slog.Debug("Failed to write symbol cache", "path", path, "error", err)
+	}
+}
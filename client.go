@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The gemini package doesn't cover every endpoint, so the remaining ones
+// are requested directly using the same credentials.
+
+const (
+	API_URL_LIVE    = "https://api.gemini.com"
+	API_URL_SANDBOX = "https://api.sandbox.gemini.com"
+
+	REDACT_MIN_LENGTH = 8
+)
+
+type apiError struct {
+	Result  string `json:"result"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Reason, e.Message)
+}
+
+// retryableError wraps a rate limit or server error, along with any delay
+// the server asked for before trying again.
+type retryableError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// baseUrlTransport sends requests meant for the exchange to another base
+// URL, so that the gemini package can be pointed at a mock server or a
+// different endpoint.
+type baseUrlTransport struct {
+	base *url.URL
+	next http.RoundTripper
+}
+
+func (t *baseUrlTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != apiHost(API_URL_LIVE) && req.URL.Host != apiHost(API_URL_SANDBOX) {
+		return t.next.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.base.Scheme
+	req.URL.Host = t.base.Host
+	req.URL.Path = strings.TrimRight(t.base.Path, "/") + req.URL.Path
+	req.Host = t.base.Host
+
+	return t.next.RoundTrip(req)
+}
+
+// cancelBody releases a request's context once its response is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// contextTransport bounds each request by --request-timeout and aborts it
+// when requestCtx is cancelled on interrupt. It sits under the gemini
+// package as well as the direct requests, which don't take a context
+// themselves.
+type contextTransport struct {
+	next http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if requestTimeout > 0 {
+		ctx, cancel = context.WithTimeout(req.Context(), requestTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(req.Context())
+	}
+
+	go func() {
+		select {
+		case <-requestCtx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelBody{resp.Body, cancel}
+	return resp, nil
+}
+
+// debugTransport logs each request and its response to stderr. The API
+// key is shortened and the signature masked; the payload is decoded since
+// it only holds the request path, nonce and params. Everything else goes
+// through redact in case a secret was echoed back.
+type debugTransport struct {
+	next http.RoundTripper
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fmt.Fprintf(os.Stderr, "> %s %s\n", req.Method, redact(req.URL.String()))
+
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := strings.Join(req.Header[name], ",")
+
+		switch http.CanonicalHeaderKey(name) {
+		case "X-Gemini-Apikey":
+			value = maskSecret(value)
+		case "X-Gemini-Signature", "X-Webhook-Signature":
+			value = "***"
+		case "X-Gemini-Payload":
+			if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+				value = string(decoded)
+			}
+		}
+
+		fmt.Fprintf(os.Stderr, "> %s: %s\n", name, redact(value))
+	}
+
+	start := time.Now()
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "< error after %v: %s\n", time.Since(start), redact(err.Error()))
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	fmt.Fprintf(os.Stderr, "< %s (%v)\n", resp.Status, time.Since(start))
+	fmt.Fprintf(os.Stderr, "< %s\n", redact(string(body)))
+
+	return resp, nil
+}
+
+func doRequest(req *http.Request, v interface{}) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var err error = fmt.Errorf("%s", resp.Status)
+
+		apiErr := &apiError{}
+		if json.Unmarshal(body, apiErr) == nil && apiErr.Reason != "" {
+			err = apiErr
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+			return &retryableError{err, time.Duration(seconds) * time.Second}
+		}
+
+		return err
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+func apiHost(apiUrl string) string {
+	return strings.TrimPrefix(apiUrl, "https://")
+}
+
+func getApiUrl(live bool) string {
+	if live {
+		return API_URL_LIVE
+	}
+	return API_URL_SANDBOX
+}
+
+// maskSecret keeps only the first and last few characters of s.
+func maskSecret(s string) string {
+	if len(s) <= 8 {
+		return "***"
+	}
+	return s[:4] + "***" + s[len(s)-4:]
+}
+
+// signaturePattern matches a hex encoded request signature, an HMAC-SHA384,
+// and the HMAC-SHA256 sent with webhooks.
+var signaturePattern = regexp.MustCompile(`\b[0-9a-f]{96}\b|sha256=[0-9a-f]{64}`)
+
+var (
+	redactions     []string
+	redactionMutex sync.Mutex
+)
+
+// addRedaction registers a secret read after startup, such as a webhook
+// secret, for redact to mask along with the API secret.
+func addRedaction(secret string) {
+	if secret == "" {
+		return
+	}
+
+	redactionMutex.Lock()
+	defer redactionMutex.Unlock()
+
+	for _, r := range redactions {
+		if r == secret {
+			return
+		}
+	}
+	redactions = append(redactions, secret)
+}
+
+// redact masks the API secret, any registered secret and anything that
+// looks like a signature in s. It is applied to everything written to
+// stderr that might include a request or an error. Secrets shorter than
+// REDACT_MIN_LENGTH can't be real ones and would mask ordinary words, so
+// they're left alone.
+func redact(s string) string {
+	if len(gemini_api_secret) >= REDACT_MIN_LENGTH {
+		s = strings.ReplaceAll(s, gemini_api_secret, "***")
+	}
+
+	redactionMutex.Lock()
+	for _, r := range redactions {
+		if len(r) >= REDACT_MIN_LENGTH {
+			s = strings.ReplaceAll(s, r, "***")
+		}
+	}
+	redactionMutex.Unlock()
+
+	return signaturePattern.ReplaceAllString(s, "***")
+}
+
+// privateRequest POSTs a signed request to a private endpoint and decodes
+// the response into v. Any params are added to the signed payload.
+func privateRequest(path string, params map[string]interface{}, v interface{}) error {
+	header, err := signedHeader(path, params)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", gemini_api_url+path, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header = header
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Content-Length", "0")
+	req.Header.Set("Cache-Control", "no-cache")
+
+	return doRequest(req, v)
+}
+
+// publicRequest GETs a public endpoint and decodes the response into v.
+func publicRequest(path string, v interface{}) error {
+	req, err := http.NewRequest("GET", gemini_api_url+path, nil)
+	if err != nil {
+		return err
+	}
+
+	return doRequest(req, v)
+}
+
+var (
+	lastNonce  int64
+	nonceMutex sync.Mutex
+)
+
+// nextNonce returns the current time in nanoseconds, bumped past the last
+// nonce handed out when the clock hasn't moved on, since the exchange
+// rejects a nonce that doesn't increase.
+func nextNonce() int64 {
+	nonceMutex.Lock()
+	defer nonceMutex.Unlock()
+
+	nonce := time.Now().UnixNano()
+	if nonce <= lastNonce {
+		slog.Debug("Adjusted nonce", "nonce", lastNonce+1, "clock", nonce)
+		nonce = lastNonce + 1
+	}
+	lastNonce = nonce
+
+	return nonce
+}
+
+// signedHeader returns the authentication headers for a private request
+// to path, signing a payload with a fresh nonce and any params.
+func signedHeader(path string, params map[string]interface{}) (http.Header, error) {
+	if paperTrading {
+		return nil, errors.New(ERROR_PAPER_MODE)
+	}
+
+	payload := map[string]interface{}{
+		"request": path,
+		"nonce":   strconv.FormatInt(nextNonce(), 10),
+	}
+	for key, value := range params {
+		payload[key] = value
+	}
+
+	chars, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(chars)
+
+	mac := hmac.New(sha512.New384, []byte(gemini_api_secret))
+	mac.Write([]byte(encoded))
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	header := http.Header{}
+	header.Set("X-GEMINI-APIKEY", gemini_api_key)
+	header.Set("X-GEMINI-PAYLOAD", encoded)
+	header.Set("X-GEMINI-SIGNATURE", signature)
+
+	return header, nil
+}
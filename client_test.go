@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+const testSecret = "2Rk9bQ7xZp4LmW8cVt3N"
+
+// setSecret makes secret the API secret, and the only thing redact masks
+// besides signatures, for the rest of the test.
+func setSecret(t *testing.T, secret string) {
+	t.Helper()
+
+	savedSecret := gemini_api_secret
+	redactionMutex.Lock()
+	savedRedactions := redactions
+	redactions = nil
+	redactionMutex.Unlock()
+
+	gemini_api_secret = secret
+
+	t.Cleanup(func() {
+		gemini_api_secret = savedSecret
+		redactionMutex.Lock()
+		redactions = savedRedactions
+		redactionMutex.Unlock()
+	})
+}
+
+// captureStderr returns what fn writes to os.Stderr.
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = saved }()
+
+	done := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- out
+	}()
+
+	fn()
+	w.Close()
+
+	return string(<-done)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRedact(t *testing.T) {
+	setSecret(t, testSecret)
+	addRedaction("whsec_4f9a1c2e")
+
+	signature := strings.Repeat("ab12", 24)
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"nothing secret", "nothing secret"},
+		{"secret " + testSecret, "secret ***"},
+		{"https://api.gemini.com/v1/order?key=" + testSecret + "&x=" + testSecret, "https://api.gemini.com/v1/order?key=***&x=***"},
+		{"bad signature " + signature, "bad signature ***"},
+		{"X-Webhook-Signature: sha256=" + strings.Repeat("0f", 32), "X-Webhook-Signature: ***"},
+		{"webhook secret whsec_4f9a1c2e rejected", "webhook secret *** rejected"},
+	}
+
+	for _, tt := range tests {
+		got := redact(tt.in)
+		if got != tt.want {
+			t.Errorf("redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactShortSecrets(t *testing.T) {
+	short := strings.Repeat("a", REDACT_MIN_LENGTH-1)
+
+	setSecret(t, short)
+	addRedaction("order")
+
+	in := "order " + short + " has a banana"
+	got := redact(in)
+	if got != in {
+		t.Errorf("redact(%q) = %q, want it unchanged", in, got)
+	}
+
+	// one character more and it's long enough to mask
+	setSecret(t, short+"a")
+	if got := redact("secret " + short + "a"); got != "secret ***" {
+		t.Errorf("redact of a %d character secret = %q, want it masked", REDACT_MIN_LENGTH, got)
+	}
+}
+
+func TestRedactLog(t *testing.T) {
+	setSecret(t, testSecret)
+
+	var buf bytes.Buffer
+	logger := slog.New(newLogHandler(&buf, slog.LevelDebug))
+
+	logger.Debug("Signed request with "+testSecret, "payload", `{"secret":"`+testSecret+`"}`, "attempt", 1)
+	logger.Error(ERROR_AUDIT_LOG, "error", errors.New("write failed for "+testSecret))
+	logger.Info("Nested", slog.Group("request", "secret", testSecret))
+
+	out := buf.String()
+	if strings.Contains(out, testSecret) {
+		t.Errorf("log output has the secret:\n%s", out)
+	}
+	if n := strings.Count(out, "***"); n != 4 {
+		t.Errorf("log output has %d redactions, want 4:\n%s", n, out)
+	}
+
+	// records below the level are dropped
+	buf.Reset()
+	slog.New(newLogHandler(&buf, slog.LevelWarn)).Debug("Adjusted nonce")
+	if buf.Len() != 0 {
+		t.Errorf("debug record logged at warn level: %s", buf.String())
+	}
+}
+
+func TestRedactStderr(t *testing.T) {
+	setSecret(t, testSecret)
+
+	noColor, ctx := color.NoColor, requestCtx
+	color.NoColor, requestCtx = true, context.Background()
+	t.Cleanup(func() { color.NoColor, requestCtx = noColor, ctx })
+
+	payload := base64.StdEncoding.EncodeToString([]byte(`{"request":"/v1/order/new","secret":"` + testSecret + `"}`))
+
+	out := captureStderr(t, func() {
+		printError(errors.New("rejected " + testSecret))
+
+		req, _ := http.NewRequest("POST", "https://api.gemini.com/v1/order/new?echo="+testSecret, nil)
+		req.Header.Set("X-GEMINI-PAYLOAD", payload)
+		req.Header.Set("X-GEMINI-SIGNATURE", strings.Repeat("c0ffee", 16))
+
+		debug := &debugTransport{roundTripFunc(func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("connection reset, key " + testSecret)
+		})}
+		debug.RoundTrip(req)
+	})
+
+	if strings.Contains(out, testSecret) {
+		t.Errorf("stderr has the secret:\n%s", out)
+	}
+	if !strings.Contains(out, "Error: rejected ***") {
+		t.Errorf("stderr is missing the redacted error:\n%s", out)
+	}
+	if strings.Contains(out, "c0ffee") {
+		t.Errorf("stderr has the signature:\n%s", out)
+	}
+}
@@ -4,378 +4,2789 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jsgoyette/gemini"
 	"github.com/urfave/cli"
 )
 
-func active(c *cli.Context) error {
-	activeOrders, err := g.ActiveOrders()
+// account prints the account the API key belongs to and the key's roles,
+// as a check before trading with it.
+func account(c *cli.Context) error {
+	info, err := getAccount()
 	if err != nil {
 		printError(err)
 		return err
 	}
 
-	if c.Bool("json") {
-		chars, _ := json.Marshal(activeOrders)
-		fmt.Println(string(chars))
+	if jsonOutput(c) {
+		printJSON(info)
 		return nil
 	}
 
-	for idx, order := range activeOrders {
-		printOrder(order)
-		if idx < len(activeOrders)-1 {
-			fmt.Println("")
-		}
+	mode := "sandbox"
+	if info.Live {
+		mode = red("live")
 	}
 
+	w := newTabWriter()
+
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Name"), boldWhite(info.Name))
+	fmt.Fprintf(w, "%s:\t%s\n", blue("ShortName"), info.ShortName)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Type"), info.Type)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Created"), formatTimestamp(info.CreatedMS, time.Millisecond))
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Roles"), strings.Join(info.Roles, ", "))
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Mode"), mode)
+
+	w.Flush()
+
 	return nil
 }
 
-func balances(c *cli.Context) error {
-	balances, err := g.Balances()
+func active(c *cli.Context, ex exchange) error {
+	var activeOrders []gemini.Order
+	err := withRetry(func() (err error) {
+		activeOrders, err = ex.ActiveOrders()
+		return err
+	})
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	var mkt, side string
+	if c.IsSet("mkt") {
+		mkt = getMarket(c)
+	}
+	if c.IsSet("side") {
+		side = strings.ToLower(c.String("side"))
+	}
+
+	activeOrders = filterOrders(activeOrders, mkt, side, 0)
+
+	err = sortOrders(activeOrders, c.String("sort"), c.Bool("desc"))
 	if err != nil {
 		printError(err)
 		return err
 	}
 
-	if c.Bool("json") {
-		chars, _ := json.Marshal(balances)
-		fmt.Println(string(chars))
+	if c.Bool("csv") {
+		err := printOrdersCSV(activeOrders, c.String("fields"))
+		if err != nil {
+			printError(err)
+		}
+		return err
+	}
+
+	if jsonOutput(c) {
+		printJSON(activeOrders)
+		return nil
+	}
+
+	if c.Bool("table") {
+		err := printOrdersTable(activeOrders, c.String("fields"))
+		if err != nil {
+			printError(err)
+			return err
+		}
+	} else {
+		for _, order := range activeOrders {
+			printOrder(order)
+			printSeparator()
+		}
+	}
+
+	if quiet {
 		return nil
 	}
 
-	for _, fund := range balances {
-		fmt.Printf("%s: %v\n", blue(fund.Currency), fund.Amount)
+	// markets quoted in different currencies can't be added together
+	notional := map[string]float64{}
+	for _, order := range activeOrders {
+		details, err := getSymbolDetails(order.Symbol)
+		if err != nil {
+			printError(err)
+			return err
+		}
+
+		notional[strings.ToUpper(details.QuoteCurrency)] += order.RemainingAmount * order.Price
+	}
+
+	totals := make([]string, 0, len(notional))
+	for _, currency := range sortedKeys(notional) {
+		totals = append(totals, fmt.Sprintf("%.*f %s", precision, notional[currency], currency))
 	}
 
+	line := fmt.Sprintf("%s: %d", blue("Orders"), len(activeOrders))
+	if len(totals) > 0 {
+		line += fmt.Sprintf(", %s: %s", blue("Notional"), strings.Join(totals, ", "))
+	}
+	fmt.Fprintln(stdout, line)
+
 	return nil
 }
 
-func book(c *cli.Context) error {
+// alert polls the last price of mkt until it reaches --above or falls to
+// --below, printing the price that triggered it.
+func alert(c *cli.Context, ex exchange) error {
+	mkt := getMarket(c)
+	above := c.Float64("above")
+	below := c.Float64("below")
 
-	mkt := c.String("mkt")
-	lim := c.Int("lim")
+	if above <= 0 && below <= 0 {
+		err := errors.New(ERROR_NO_THRESHOLD)
+		printError(err)
+		return err
+	}
 
-	book, err := g.OrderBook(mkt, lim, lim)
-	if err != nil {
+	interval := c.Int("interval")
+	if interval <= 0 {
+		err := errors.New(ERROR_INVALID_INTERVAL)
 		printError(err)
 		return err
 	}
 
-	if c.Bool("json") {
-		chars, _ := json.Marshal(book)
-		fmt.Println(string(chars))
-		return nil
+	var deadline time.Time
+	if c.Duration("timeout") > 0 {
+		deadline = time.Now().Add(c.Duration("timeout"))
 	}
 
-	for i := len(book.Asks) - 1; i >= 0; i-- {
-		ask := book.Asks[i]
+	for {
+		price, err := getPrice(ex, mkt, "last")
+		if err != nil {
+			printError(err)
+			return err
+		}
 
-		askAmount := fmt.Sprintf("%.8f", ask.Amount)
-		askPrice := fmt.Sprintf("%.8f", ask.Price)
+		res := alertResult{Market: mkt, Price: price}
+		if above > 0 && price >= above {
+			res.Condition, res.Threshold = "above", above
+		} else if below > 0 && price <= below {
+			res.Condition, res.Threshold = "below", below
+		}
 
-		if i == 0 {
-			fmt.Printf("%s\t%s\n", boldWhite(askPrice), askAmount)
-		} else {
-			fmt.Printf("%s\t%s\n", blue(askPrice), askAmount)
+		if res.Condition != "" {
+			if jsonOutput(c) {
+				printJSON(res)
+			} else {
+				fmt.Fprintln(stdout, strconv.FormatFloat(price, 'f', -1, 64))
+			}
+			return nil
 		}
-	}
 
-	fmt.Println("")
+		wait := time.Duration(interval) * time.Second
 
-	for i, l := 0, len(book.Bids); i < l; i++ {
-		bid := book.Bids[i]
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				err := errors.New(ERROR_ALERT_TIMEOUT)
+				printError(err)
+				return err
+			}
 
-		bidAmount := fmt.Sprintf("%.8f", bid.Amount)
-		bidPrice := fmt.Sprintf("%.8f", bid.Price)
+			// poll one last time at the deadline
+			if remaining < wait {
+				wait = remaining
+			}
+		}
 
-		if i == 0 {
-			fmt.Printf("%s\t%s\n", boldWhite(bidPrice), bidAmount)
-		} else {
-			fmt.Printf("%s\t%s\n", blue(bidPrice), bidAmount)
+		err = sleep(wait)
+		if err != nil {
+			printError(err)
+			return err
 		}
 	}
-
-	return nil
 }
 
-func cancel(c *cli.Context) error {
-	order, err := g.CancelOrder(c.String("txid"))
-	if err != nil {
-		printError(err)
-		return err
+// arb prices ethusd through btc and reports how far that is from the
+// direct ethusd market, flagging a gap beyond --threshold percent.
+func arb(c *cli.Context, ex exchange) error {
+	threshold := c.Float64("threshold")
+
+	mids := map[string]float64{}
+	for _, mkt := range []string{"btcusd", "ethbtc", "ethusd"} {
+		top, err := getTopOfBook(ex, mkt)
+		if err != nil {
+			err = fmt.Errorf("%s: %v", mkt, err)
+			printError(err)
+			return err
+		}
+		mids[mkt] = top.Mid
+	}
+
+	check := arbCheck{
+		BtcUsd:    mids["btcusd"],
+		EthBtc:    mids["ethbtc"],
+		EthUsd:    mids["ethusd"],
+		Implied:   mids["btcusd"] * mids["ethbtc"],
+		Threshold: threshold,
 	}
+	check.GapPct = (check.Implied - check.EthUsd) / check.EthUsd * 100
+	check.Flagged = math.Abs(check.GapPct) > threshold
 
-	if c.Bool("json") {
-		chars, _ := json.Marshal(order)
-		fmt.Println(string(chars))
+	if jsonOutput(c) {
+		printJSON(check)
 		return nil
 	}
 
-	printOrder(order)
+	gap := fmt.Sprintf("%.4f%%", check.GapPct)
+	if check.Flagged {
+		gap = red(gap + " above threshold")
+	}
+
+	w := newTabWriter()
+
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("btcusd"), precision, check.BtcUsd)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("ethbtc"), precision, check.EthBtc)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("ethusd"), precision, check.EthUsd)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Implied"), boldWhite(fmt.Sprintf("%.*f", precision, check.Implied)))
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Gap"), gap)
+
+	w.Flush()
+
 	return nil
 }
 
-func cancelAll(c *cli.Context) error {
-	res, err := g.CancelAll()
+func auction(c *cli.Context, ex exchange) error {
+	mkt := getMarket(c)
+
+	var a gemini.Auction
+	err := withRetry(func() (err error) {
+		a, err = ex.Auction(mkt)
+		return err
+	})
 	if err != nil {
 		printError(err)
 		return err
 	}
 
-	if c.Bool("json") {
-		chars, _ := json.Marshal(res)
-		fmt.Println(string(chars))
+	if jsonOutput(c) {
+		printJSON(a)
+		return nil
+	}
+
+	if a.NextAuctionMS == 0 {
+		fmt.Fprintf(stdout, "No auction scheduled for %s\n", mkt)
 		return nil
 	}
 
-	fmt.Printf("%s: %+v\n", blue("Cancelled Orders"), res.Details.CancelledOrders)
-	fmt.Printf("%s: %+v\n", blue("Rejected Orders"), res.Details.CancelRejects)
+	w := newTabWriter()
+
+	fmt.Fprintf(w, "%s:\t%s\n", blue("NextAuction"), boldWhite(formatTimestamp(a.NextAuctionMS, time.Millisecond)))
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("IndicativePrice"), precision, a.MostRecentIndicativePrice)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("IndicativeQuantity"), precision, a.MostRecentIndicativeQuantity)
+
+	w.Flush()
 
 	return nil
 }
 
-func limit(c *cli.Context) error {
+// backtest replays a strategy over the market's candles, oldest first.
+func backtest(c *cli.Context) error {
+	mkt := getMarket(c)
+	interval := c.String("interval")
 
-	amount := c.Float64("amt")
-	baseAmount := c.Float64("base-amt")
-	bps := c.Int("bps")
-	mkt := c.String("mkt")
-	price := c.Float64("price")
-	side := c.String("side")
+	err := checkCandleInterval(interval)
+	if err != nil {
+		printError(err)
+		return err
+	}
 
-	if amount <= 0.0 && baseAmount <= 0.0 {
-		err := errors.New(ERROR_INVALID_AMOUNT)
+	fast, slow, err := parseSmaCross(c.String("sma-cross"))
+	if err != nil {
 		printError(err)
 		return err
 	}
 
-	if price <= 0.0 {
-		err := errors.New(ERROR_INVALID_PRICE)
+	capital := c.Float64("capital")
+	if capital <= 0 {
+		err := errors.New(ERROR_INVALID_CAPITAL)
 		printError(err)
 		return err
 	}
 
-	var btcAmount float64
+	candles, err := getCandles(mkt, interval)
+	if err != nil {
+		printError(err)
+		return err
+	}
 
-	decimals := 8
-	if mkt != "btcusd" {
-		decimals = 6
+	// candles come back most recent first
+	for i, j := 0, len(candles)-1; i < j; i, j = i+1, j-1 {
+		candles[i], candles[j] = candles[j], candles[i]
 	}
 
-	feeRatio := getFeeRatio(bps)
+	report := backtestSmaCross(candles, fast, slow, capital, c.Int("fee-bps"))
+	report.Market = mkt
+	report.Interval = interval
 
-	if side == "buy" {
-		amount -= amount * feeRatio
-	} else {
-		amount += amount * feeRatio
+	if jsonOutput(c) {
+		printJSON(report)
+		return nil
 	}
 
-	if amount > 0 {
-		btcAmount = round(amount/price, decimals)
-	} else {
-		btcAmount = round(baseAmount, decimals)
-	}
+	w := newTabWriter()
 
-	// commit trade
-	order, err := g.NewOrder(mkt, "", btcAmount, price, side, []string{"maker-or-cancel"})
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Strategy"), report.Strategy)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("From"), formatTimestamp(report.From, time.Millisecond))
+	fmt.Fprintf(w, "%s:\t%s\n", blue("To"), formatTimestamp(report.To, time.Millisecond))
+	fmt.Fprintf(w, "%s:\t%d\n", blue("Candles"), report.Candles)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("RealizedPnl"), boldWhite(fmt.Sprintf("%.*f", precision, report.RealizedPnl)))
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("Fees"), precision, report.Fees)
+	fmt.Fprintf(w, "%s:\t%d\n", blue("Trades"), report.Trades)
+	fmt.Fprintf(w, "%s:\t%d of %d (%.2f%%)\n", blue("Wins"), report.Wins, report.RoundTrips, report.WinRate)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("Position"), precision, report.Position)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("StartEquity"), precision, report.StartEquity)
+	fmt.Fprintf(w, "%s:\t%.*f (%.2f%%)\n", blue("EndEquity"), precision, report.EndEquity, report.ReturnPct)
+
+	w.Flush()
+
+	return nil
+}
+
+func balances(c *cli.Context, ex exchange) error {
+	var balances []gemini.FundBalance
+	err := withRetry(func() (err error) {
+		balances, err = ex.Balances()
+		return err
+	})
 	if err != nil {
 		printError(err)
 		return err
 	}
 
-	if c.Bool("json") {
-		chars, _ := json.Marshal(order)
-		fmt.Println(string(chars))
+	currency := strings.ToLower(c.String("currency"))
+
+	if c.Bool("available-only") {
+		return printAvailable(balances, currency)
+	}
+
+	if currency != "" {
+		fund := findBalance(balances, currency)
+
+		if quiet && !c.Bool("csv") && !jsonOutput(c) {
+			fmt.Fprintln(stdout, strconv.FormatFloat(fund.Amount, 'f', -1, 64))
+			return nil
+		}
+
+		balances = []gemini.FundBalance{fund}
+	}
+
+	if c.Bool("nonzero") && !jsonOutput(c) && currency == "" {
+		balances = filterBalances(balances)
+	}
+
+	if c.Bool("csv") {
+		err := printBalancesCSV(balances, c.String("fields"))
+		if err != nil {
+			printError(err)
+		}
+		return err
+	}
+
+	if jsonOutput(c) {
+		printJSON(balances)
 		return nil
 	}
 
-	printOrder(order)
+	// the values are left off if pricing fails, but the balances are
+	// still worth showing
+	report, err := valuePortfolio(ex, balances, "usd")
+
+	printBalances(balances, report)
+
+	if err != nil {
+		printError(err)
+		return err
+	}
+
 	return nil
 }
 
-func market(c *cli.Context) error {
+func batch(c *cli.Context, ex exchange) error {
+	path := c.String("file")
+	dryRun := c.Bool("dry-run")
 
-	amount := c.Float64("amt")
-	baseAmount := c.Float64("base-amt")
-	bps := c.Int("bps")
-	mkt := c.String("mkt")
-	side := c.String("side")
+	if path == "" {
+		err := errors.New(ERROR_MISSING_FILE)
+		printError(err)
+		return err
+	}
 
-	if amount <= 0.0 && baseAmount <= 0.0 {
-		err := errors.New(ERROR_INVALID_AMOUNT)
+	specs, err := readOrderSpecs(path, getMarket(c))
+	if err != nil {
 		printError(err)
 		return err
 	}
 
-	retries := 0
-	executedAmt := 0.0
-	orders := make([]gemini.Order, 0, 10)
+	makerBps := getFeeBps(c, true)
+	takerBps := getFeeBps(c, false)
+
+	if !dryRun {
+		err := confirmOrder(c, fmt.Sprintf("Place %d orders from %s?", len(specs), path))
+		if err != nil {
+			printError(err)
+			return err
+		}
+	}
+
+	failed := 0
+
+	for i, spec := range specs {
+		order, err := placeOrderSpec(ex, spec, makerBps, takerBps, dryRun)
+
+		switch {
+		case err != nil:
+			failed++
+			fmt.Fprintf(stdout, "%s %d: %s: %s\n", blue("Order"), i+1, spec, red(err))
+		case order == nil:
+			fmt.Fprintf(stdout, "%s %d: %s: %s\n", blue("Order"), i+1, spec, "ok")
+		default:
+			fmt.Fprintf(stdout, "%s %d: %s: %s executed %v\n", blue("Order"), i+1, spec, boldWhite(order.OrderId), order.ExecutedAmount)
+		}
+	}
+
+	fmt.Fprintf(stdout, "%s: %d, %s: %d\n", blue("Succeeded"), len(specs)-failed, blue("Failed"), failed)
 
-	decimals := 8
-	if mkt != "btcusd" {
-		decimals = 6
+	if failed > 0 {
+		return fmt.Errorf("%d of %d orders failed", failed, len(specs))
 	}
 
-	minAmt := 0.000001
-	if (mkt == "btcusd" || mkt == "ethusd") && amount > 0 {
-		minAmt = 0.01
+	return nil
+}
+
+func book(c *cli.Context, ex exchange) error {
+
+	mkt := getMarket(c)
+	bidLim := c.Int("lim")
+	askLim := c.Int("lim")
+
+	if c.IsSet("bid-lim") {
+		bidLim = c.Int("bid-lim")
 	}
-	if (mkt == "ethbtc" || mkt == "ethusd") && baseAmount > 0 {
-		minAmt = 0.0001
+	if c.IsSet("ask-lim") {
+		askLim = c.Int("ask-lim")
 	}
 
-	feeRatio := getFeeRatio(bps)
+	var book gemini.Book
+	err := withRetry(func() (err error) {
+		book, err = ex.OrderBook(mkt, bidLim, askLim)
+		return err
+	})
+	if err != nil {
+		printError(err)
+		return err
+	}
 
-	if side == "buy" {
-		amount -= amount * feeRatio
-	} else {
-		amount += amount * feeRatio
+	if jsonOutput(c) {
+		printJSON(book)
+		return nil
 	}
 
-	for {
+	printBook(book, c.Bool("cumulative"))
 
-		if retries == RETRIES_MAX {
-			err := errors.New(ERROR_MAX_RETRIES)
-			printError(err)
-			return err
-		}
+	return nil
+}
 
-		var fillAmount, btcAmount float64
+func candles(c *cli.Context) error {
+	mkt := getMarket(c)
+	interval := c.String("interval")
 
-		bookEntry, err := getOrderBookEntry(mkt, side)
+	err := checkCandleInterval(interval)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	candles, err := getCandles(mkt, interval)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if c.Bool("csv") {
+		err := writeCSV(candleTable(candles))
 		if err != nil {
 			printError(err)
-			return err
 		}
+		return err
+	}
 
-		if amount > 0 {
-			fillAmount = amount
-		} else {
-			fillAmount = baseAmount
-		}
+	if jsonOutput(c) {
+		printJSON(candles)
+		return nil
+	}
 
-		if executedAmt > 0 {
-			fillAmount = fillAmount - executedAmt
-		}
+	printTable(candleTable(candles))
 
-		if amount > 0 {
-			btcAmount = round(fillAmount/bookEntry.Price, decimals)
-		} else {
-			btcAmount = round(fillAmount, decimals)
-		}
+	return nil
+}
 
-		// commit trade
-		order, err := g.NewOrder(mkt, "", btcAmount, bookEntry.Price, side, []string{"immediate-or-cancel"})
+func cancel(c *cli.Context, ex exchange) error {
+	return eachTxid(c, func(txid string) (gemini.Order, error) {
+		return ex.CancelOrder(txid)
+	})
+}
+
+// cancelAll cancels every active order. A dry run lists the orders that
+// would be cancelled instead.
+func cancelAll(c *cli.Context, ex exchange) error {
+	if c.Bool("dry-run") {
+		var orders []gemini.Order
+		err := withRetry(func() (err error) {
+			orders, err = ex.ActiveOrders()
+			return err
+		})
 		if err != nil {
 			printError(err)
 			return err
 		}
 
-		if c.Bool("unsafe") == false {
-			printOrder(order)
+		if jsonOutput(c) {
+			printJSON(orders)
 			return nil
 		}
 
-		if c.Bool("json") {
-			orders = append(orders, order)
-		} else {
-			printOrder(order)
-		}
-
-		if amount > 0 {
-			executedAmt += order.ExecutedAmount * order.AvgExecutionPrice
-		} else {
-			executedAmt += order.ExecutedAmount
+		if quiet {
+			for _, order := range orders {
+				printOrder(order)
+			}
+			return nil
 		}
 
-		if (amount > 0 && executedAmt >= amount-minAmt) || (baseAmount > 0 && executedAmt >= baseAmount-minAmt) {
-			if c.Bool("json") {
-				chars, _ := json.Marshal(orders)
-				fmt.Println(string(chars))
+		fmt.Fprintf(stdout, "%s %d\n", blue("Would cancel"), len(orders))
+		if len(orders) > 0 {
+			err = printOrdersTable(orders, "")
+			if err != nil {
+				printError(err)
+				return err
 			}
-			return nil
 		}
+		return nil
+	}
 
-		fmt.Println("")
-		retries++
+	err := confirmOrder(c, "Cancel all active orders?")
+	if err != nil {
+		printError(err)
+		return err
 	}
-}
 
-func status(c *cli.Context) error {
-	order, err := g.OrderStatus(c.String("txid"))
+	res, err := ex.CancelAll()
 	if err != nil {
 		printError(err)
 		return err
 	}
 
-	if c.Bool("json") {
-		chars, _ := json.Marshal(order)
-		fmt.Println(string(chars))
+	if jsonOutput(c) {
+		printJSON(res)
 		return nil
 	}
 
-	printOrder(order)
+	printCancelResult(res, nil)
 
 	return nil
 }
 
-func ticker(c *cli.Context) error {
-	t, err := g.Ticker(c.String("mkt"))
+// cancelByClientId cancels every live order placed with the client order
+// id.
+func cancelByClientId(c *cli.Context, ex exchange) error {
+	orders, err := getOrdersByClientId(c.String("client-order-id"))
 	if err != nil {
 		printError(err)
 		return err
 	}
 
-	if c.Bool("json") {
-		chars, _ := json.Marshal(t)
-		fmt.Println(string(chars))
+	live := make([]gemini.Order, 0, len(orders))
+	for _, order := range orders {
+		if order.IsLive {
+			live = append(live, order)
+		}
+	}
+
+	res := cancelOrders(ex, live)
+
+	if jsonOutput(c) {
+		printJSON(res)
 		return nil
 	}
 
-	fmt.Printf("%s:\t%s\n", blue("Bid"), boldWhite(t.Bid))
-	fmt.Printf("%s:\t%s\n", blue("Ask"), boldWhite(t.Ask))
-	fmt.Printf("%s:\t%.8f\n", blue("Last"), t.Last)
-	fmt.Printf("%s:\t%v\n", blue("Volume"), t.Volume.BTC)
+	printCancelResult(res, nil)
 
 	return nil
 }
 
-func trades(c *cli.Context) error {
-	mkt := c.String("mkt")
-	lim := c.Int("lim")
-	timestamp := c.Int64("time")
-	date := c.String("date")
-
-	if date != "" {
-		t, err := getTimeFromDate(date)
-		if err != nil {
-			printError(err)
-			return err
-		}
+// cancelMatching cancels the active orders that match the given filters,
+// one at a time, leaving everything else on the book.
+func cancelMatching(c *cli.Context, ex exchange) error {
+	var mkt, side string
+	var before int64
 
-		timestamp = t
+	if c.IsSet("mkt") {
+		mkt = getMarket(c)
+	}
+	if c.IsSet("side") {
+		side = strings.ToLower(c.String("side"))
+	}
+	if c.Duration("older-than") > 0 {
+		before = time.Now().Add(-c.Duration("older-than")).Unix()
 	}
 
-	pastTrades, err := g.PastTrades(mkt, lim, timestamp)
+	var orders []gemini.Order
+	err := withRetry(func() (err error) {
+		orders, err = ex.ActiveOrders()
+		return err
+	})
 	if err != nil {
 		printError(err)
 		return err
 	}
 
-	if c.Bool("json") {
-		chars, _ := json.Marshal(pastTrades)
-		fmt.Println(string(chars))
-		return nil
+	matched := filterOrders(orders, mkt, side, before)
+
+	res := cancelSummary{
+		CancelResult: cancelOrders(ex, matched),
+		Skipped:      make([]string, 0, len(orders)-len(matched)),
 	}
 
-	for idx, trade := range pastTrades {
-		printTrade(trade)
-		if idx < len(pastTrades)-1 {
-			fmt.Println("")
+	for _, order := range orders {
+		if !containsOrder(matched, order.OrderId) {
+			res.Skipped = append(res.Skipped, order.OrderId)
 		}
 	}
 
+	if jsonOutput(c) {
+		printJSON(res)
+		return nil
+	}
+
+	printCancelResult(res.CancelResult, res.Skipped)
+
+	return nil
+}
+
+func completion(c *cli.Context) error {
+	shell := c.Args().First()
+
+	script, ok := completionScript(shell, c.App.Name)
+	if !ok {
+		shells := make([]string, 0, len(COMPLETION_SCRIPTS))
+		for s := range COMPLETION_SCRIPTS {
+			shells = append(shells, s)
+		}
+		sort.Strings(shells)
+
+		err := fmt.Errorf("%s: %s", ERROR_INVALID_SHELL, strings.Join(shells, ", "))
+		printError(err)
+		return err
+	}
+
+	fmt.Fprint(stdout, script)
+	return nil
+}
+
+func convert(c *cli.Context, ex exchange) error {
+	mkt := getMarket(c)
+	amount := c.Float64("amt")
+	baseAmount := c.Float64("base-amt")
+
+	if amount > 0 && baseAmount > 0 {
+		err := errors.New(ERROR_AMBIGUOUS_AMOUNT)
+		printError(err)
+		return err
+	}
+
+	if amount <= 0 && baseAmount <= 0 {
+		err := errors.New(ERROR_INVALID_AMOUNT)
+		printError(err)
+		return err
+	}
+
+	details, err := getSymbolDetails(mkt)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	price, err := getPrice(ex, mkt, strings.ToLower(c.String("field")))
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	baseDecimals := getDecimals(details.TickSize)
+	quoteDecimals := getDecimals(details.QuoteIncrement)
+
+	if amount > 0 {
+		baseAmount = round(amount/price, baseDecimals)
+	} else {
+		amount = round(baseAmount*price, quoteDecimals)
+	}
+
+	res := conversion{
+		Market:      mkt,
+		Price:       price,
+		BaseAmount:  baseAmount,
+		QuoteAmount: amount,
+		FeeBps:      c.Int("bps"),
+		Fee:         round(amount*getFeeRatio(c.Int("bps")), quoteDecimals),
+	}
+
+	if jsonOutput(c) {
+		printJSON(res)
+		return nil
+	}
+
+	printConversion(res, details)
+
+	return nil
+}
+
+// dca buys a fixed quote amount every interval, count times or until
+// interrupted, through the same path as batch orders. A failed round is
+// reported and the schedule carries on unless --stop-on-error is set.
+func dca(c *cli.Context, ex exchange) error {
+	mkt := getMarket(c)
+	amount := c.Float64("amt")
+	count := c.Int("count")
+	interval := c.Duration("interval")
+	orderType := strings.ToLower(c.String("type"))
+	dryRun := c.Bool("dry-run")
+
+	if amount <= 0 {
+		err := errors.New(ERROR_INVALID_AMOUNT)
+		printError(err)
+		return err
+	}
+
+	if interval <= 0 {
+		err := errors.New(ERROR_INVALID_INTERVAL)
+		printError(err)
+		return err
+	}
+
+	if count < 0 {
+		err := errors.New(ERROR_INVALID_COUNT)
+		printError(err)
+		return err
+	}
+
+	if orderType != "limit" && orderType != "market" {
+		err := fmt.Errorf("%s: %s", ERROR_INVALID_TYPE, orderType)
+		printError(err)
+		return err
+	}
+
+	makerBps := getFeeBps(c, true)
+	takerBps := getFeeBps(c, false)
+
+	if !dryRun {
+		prompt := fmt.Sprintf("Buy %v worth of %s every %v?", amount, mkt, interval)
+		if count > 0 {
+			prompt = fmt.Sprintf("Buy %v worth of %s every %v, %d times?", amount, mkt, interval, count)
+		}
+
+		err := confirmOrder(c, prompt)
+		if err != nil {
+			printError(err)
+			return err
+		}
+	}
+
+	stopMetrics, err := startMetrics(c.String("metrics-addr"))
+	if err != nil {
+		printError(err)
+		return err
+	}
+	defer stopMetrics()
+
+	// stop between rounds rather than cancelling an order in flight
+	stop, release := holdInterrupt()
+	defer release()
+
+	defer startHeartbeat(c.Bool("require-heartbeat") && !dryRun)()
+
+	orders := make([]gemini.Order, 0, count)
+	rounds := 0
+	failed := 0
+
+	var lastErr error
+
+schedule:
+	for count == 0 || rounds < count {
+		rounds++
+
+		spec := orderSpec{Market: mkt, Side: "buy", Amount: amount, Type: orderType}
+
+		var order *gemini.Order
+		var err error
+
+		// limit buys rest at the best bid of the moment
+		if orderType == "limit" {
+			var top *topOfBook
+			top, err = getTopOfBook(ex, mkt)
+			if err == nil {
+				spec.Price = top.Bid
+			}
+		}
+
+		if err == nil {
+			order, err = placeOrderSpec(ex, spec, makerBps, takerBps, dryRun)
+		}
+
+		if order != nil {
+			orders = append(orders, *order)
+			notifyFill(c, *order)
+			recordOrder(mkt, *order)
+		}
+
+		res := dcaRound{Round: rounds, Timestamp: time.Now().Unix(), Price: spec.Price, Order: order}
+		if err != nil {
+			recordError("dca")
+			failed++
+			lastErr = err
+			res.Error = err.Error()
+		}
+
+		if jsonOutput(c) {
+			printJSON(res)
+		} else {
+			printDcaRound(res, spec, count)
+		}
+
+		if err != nil && c.Bool("stop-on-error") {
+			break
+		}
+
+		if count > 0 && rounds == count {
+			break
+		}
+
+		select {
+		case <-stop:
+			break schedule
+		case <-time.After(interval):
+		}
+	}
+
+	if !jsonOutput(c) && !quiet {
+		printSeparator()
+		fmt.Fprintf(stdout, "%s: %d, %s: %d\n", blue("Succeeded"), rounds-failed, blue("Failed"), failed)
+		printFillSummary(summarizeFills(orders))
+	}
+
+	if c.Bool("stop-on-error") && lastErr != nil {
+		return lastErr
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d rounds failed", failed, rounds)
+	}
+
+	return nil
+}
+
+func depositAddress(c *cli.Context, ex exchange) error {
+	currency := strings.ToLower(c.String("currency"))
+	label := c.String("label")
+
+	if currency == "" {
+		err := errors.New(ERROR_INVALID_CURRENCY)
+		printError(err)
+		return err
+	}
+
+	var addr *depositAddressResult
+	var err error
+
+	if !c.Bool("new") {
+		addr, err = getDepositAddress(currency, label)
+		if err != nil {
+			printError(err)
+			return err
+		}
+	}
+
+	// nothing to reuse, so request a fresh one
+	if addr == nil {
+		res, err := ex.NewDepositAddress(currency, label)
+		if err != nil {
+			printError(err)
+			return err
+		}
+
+		addr = &depositAddressResult{
+			Currency: currency,
+			Address:  res.Address,
+			Label:    res.Label,
+		}
+	}
+
+	if jsonOutput(c) {
+		printJSON(addr)
+		return nil
+	}
+
+	fmt.Fprintln(stdout, addr.Address)
+
+	return nil
+}
+
+func estimate(c *cli.Context, ex exchange) error {
+	amount := c.Float64("amt")
+	baseAmount := c.Float64("base-amt")
+	mkt := getMarket(c)
+	side := c.String("side")
+
+	if amount <= 0.0 && baseAmount <= 0.0 {
+		err := errors.New(ERROR_INVALID_AMOUNT)
+		printError(err)
+		return err
+	}
+
+	entries, err := getOrderBookSide(ex, mkt, side, 0)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	fill := walkBook(entries, amount, baseAmount)
+
+	if jsonOutput(c) {
+		printJSON(fill)
+		return nil
+	}
+
+	printFill(fill)
+
+	return nil
+}
+
+func fees(c *cli.Context) error {
+	volume, err := getNotionalVolume()
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if jsonOutput(c) {
+		printJSON(volume)
+		return nil
+	}
+
+	w := newTabWriter()
+
+	fmt.Fprintf(w, "%s:\t%s\n", blue("MakerBps"), boldWhite(volume.MakerFeeBps))
+	fmt.Fprintf(w, "%s:\t%s\n", blue("TakerBps"), boldWhite(volume.TakerFeeBps))
+	fmt.Fprintf(w, "%s:\t%d\n", blue("AuctionBps"), volume.AuctionFeeBps)
+	fmt.Fprintf(w, "%s:\t%.2f\n", blue("30DayVolume"), volume.Notional30dVolume)
+
+	w.Flush()
+
+	return nil
+}
+
+// heartbeat sends a heartbeat, or keeps sending one every --interval
+// seconds with --watch, so that a session requiring heartbeats stays up.
+func heartbeat(c *cli.Context) error {
+	if !c.Bool("watch") {
+		res, err := sendHeartbeat()
+		if err != nil {
+			printError(err)
+			return err
+		}
+
+		printHeartbeat(c, res)
+		return nil
+	}
+
+	interval := c.Int("interval")
+	if interval <= 0 {
+		err := errors.New(ERROR_INVALID_INTERVAL)
+		printError(err)
+		return err
+	}
+
+	// stop between heartbeats rather than failing one in flight
+	stop, release := holdInterrupt()
+	defer release()
+
+	tick := time.NewTicker(time.Duration(interval) * time.Second)
+	defer tick.Stop()
+
+	for {
+		res, err := sendHeartbeat()
+		if err != nil {
+			printError(err)
+			return err
+		}
+
+		printHeartbeat(c, res)
+
+		select {
+		case <-stop:
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+// ladder splits --base-amt across maker-or-cancel limit orders spaced from
+// --from to --to, evenly or with --geometric at a constant ratio.
+func ladder(c *cli.Context, ex exchange) error {
+	mkt := getMarket(c)
+	side := c.String("side")
+	baseAmount := c.Float64("base-amt")
+	from := c.Float64("from")
+	to := c.Float64("to")
+	n := c.Int("orders")
+	dryRun := c.Bool("dry-run")
+
+	if baseAmount <= 0 {
+		err := errors.New(ERROR_INVALID_AMOUNT)
+		printError(err)
+		return err
+	}
+
+	if from <= 0 || to <= 0 {
+		err := errors.New(ERROR_INVALID_PRICE)
+		printError(err)
+		return err
+	}
+
+	if n <= 0 {
+		err := errors.New(ERROR_INVALID_ORDERS)
+		printError(err)
+		return err
+	}
+
+	details, err := getSymbolDetails(mkt)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	prices := ladderPrices(from, to, n, c.Bool("geometric"), getDecimals(details.QuoteIncrement))
+	amounts := splitAmount(baseAmount, n, getDecimals(details.TickSize))
+
+	// every rung has to rest on the book as a maker order
+	top, err := getTopOfBook(ex, mkt)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	for _, price := range prices {
+		if (side == "buy" && price >= top.Ask) || (side == "sell" && price <= top.Bid) {
+			err := fmt.Errorf("%s: %v", ERROR_LADDER_CROSSES, price)
+			printError(err)
+			return err
+		}
+	}
+
+	if !dryRun {
+		prompt := fmt.Sprintf("Place %d %s orders for %v %s from %v to %v?", n, strings.ToUpper(side), baseAmount, mkt, prices[0], prices[n-1])
+
+		err := confirmOrder(c, prompt)
+		if err != nil {
+			printError(err)
+			return err
+		}
+	}
+
+	makerBps := getFeeBps(c, true)
+	orders := make([]gemini.Order, 0, n)
+	failed := 0
+
+	for i := range prices {
+		spec := orderSpec{Market: mkt, Side: side, BaseAmount: amounts[i], Price: prices[i], Type: "limit"}
+
+		order, err := placeOrderSpec(ex, spec, makerBps, 0, dryRun)
+		if order != nil {
+			orders = append(orders, *order)
+		}
+
+		if jsonOutput(c) {
+			if err != nil {
+				failed++
+				printError(err)
+			}
+			continue
+		}
+
+		switch {
+		case err != nil:
+			failed++
+			fmt.Fprintf(stdout, "%s %d: %s: %s\n", blue("Order"), i+1, spec, red(err))
+		case order == nil:
+			fmt.Fprintf(stdout, "%s %d: %s: %s\n", blue("Order"), i+1, spec, "ok")
+		default:
+			fmt.Fprintf(stdout, "%s %d: %s: %s\n", blue("Order"), i+1, spec, boldWhite(order.OrderId))
+		}
+	}
+
+	if jsonOutput(c) {
+		printJSON(orders)
+	} else {
+		fmt.Fprintf(stdout, "%s: %d, %s: %d\n", blue("Succeeded"), n-failed, blue("Failed"), failed)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d orders failed", failed, n)
+	}
+
+	return nil
+}
+
+func limit(c *cli.Context, ex exchange) error {
+	if c.Bool("stdin") {
+		return eachStdinSpec(c, ex, placeLimit)
+	}
+	return placeLimit(c, ex)
+}
+
+func placeLimit(c *cli.Context, ex exchange) error {
+
+	amount := c.Float64("amt")
+	baseAmount := c.Float64("base-amt")
+	bps := getFeeBps(c, true)
+	mkt := getMarket(c)
+	price := c.Float64("price")
+	side := c.String("side")
+
+	if pct := c.Float64("pct"); pct > 0 {
+		var err error
+		amount, baseAmount, err = getPctAmount(ex, mkt, side, pct)
+		if err != nil {
+			printError(err)
+			return err
+		}
+	}
+
+	if amount <= 0.0 && baseAmount <= 0.0 {
+		err := errors.New(ERROR_INVALID_AMOUNT)
+		printError(err)
+		return err
+	}
+
+	if price <= 0.0 {
+		err := errors.New(ERROR_INVALID_PRICE)
+		printError(err)
+		return err
+	}
+
+	price, err := getLimitPrice(mkt, price, c.Bool("strict"))
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	btcAmount, err := getLimitAmount(mkt, side, amount, baseAmount, price, bps)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if !c.Bool("force") {
+		err := checkDeviation(ex, mkt, side, price, c.Float64("max-deviation"))
+		if err != nil {
+			printError(err)
+			return err
+		}
+	}
+
+	prompt := fmt.Sprintf("Place %s %v %s @ %v?", strings.ToUpper(side), btcAmount, mkt, price)
+
+	err = confirmOrder(c, prompt)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	// commit trade
+	order, err := ex.NewOrder(mkt, getClientOrderId(c), btcAmount, price, side, []string{c.String("tif")})
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if c.Bool("wait") {
+		order, err = waitForOrder(c, ex, order)
+		if err != nil {
+			printError(err)
+			return err
+		}
+	}
+
+	notifyFill(c, order)
+
+	if jsonOutput(c) {
+		printJSON(order)
+		return nil
+	}
+
+	printOrder(order)
+	return nil
+}
+
+func market(c *cli.Context, ex exchange) error {
+	if c.Bool("stdin") {
+		return eachStdinSpec(c, ex, placeMarket)
+	}
+	return placeMarket(c, ex)
+}
+
+func placeMarket(c *cli.Context, ex exchange) error {
+
+	amount := c.Float64("amt")
+	baseAmount := c.Float64("base-amt")
+	bps := getFeeBps(c, false)
+	mkt := getMarket(c)
+	side := c.String("side")
+
+	if pct := c.Float64("pct"); pct > 0 {
+		var err error
+		amount, baseAmount, err = getPctAmount(ex, mkt, side, pct)
+		if err != nil {
+			printError(err)
+			return err
+		}
+	}
+
+	if amount <= 0.0 && baseAmount <= 0.0 {
+		err := errors.New(ERROR_INVALID_AMOUNT)
+		printError(err)
+		return err
+	}
+
+	if c.Int("max-requotes") <= 0 {
+		err := errors.New(ERROR_INVALID_REQUOTES)
+		printError(err)
+		return err
+	}
+
+	if !c.Bool("force") {
+		err := checkDeviation(ex, mkt, side, 0, c.Float64("max-deviation"))
+		if err != nil {
+			printError(err)
+			return err
+		}
+	}
+
+	feeRatio := getFeeRatio(bps)
+
+	if side == "buy" {
+		amount -= amount * feeRatio
+	} else {
+		amount += amount * feeRatio
+	}
+
+	prompt := fmt.Sprintf("Place %s %v %s @ market?", strings.ToUpper(side), baseAmount, mkt)
+	if amount > 0 {
+		prompt = fmt.Sprintf("Place %s %v worth of %s @ market?", strings.ToUpper(side), round(amount, 2), mkt)
+	}
+
+	err := confirmOrder(c, prompt)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	unsafe := c.Bool("unsafe") && !c.Bool("no-retry")
+	orders := make([]gemini.Order, 0, 10)
+
+	// let the order in flight finish on Ctrl-C rather than abort it
+	stop, release := holdInterrupt()
+	defer release()
+
+	err = fillMarketOrder(ex, mkt, side, getClientOrderId(c), c.String("tif"), amount, baseAmount, unsafe, c.Int("max-requotes"), stop, func(order gemini.Order) {
+		notifyFill(c, order)
+
+		// quiet lists the order ids once the loop is done
+		if (unsafe && jsonOutput(c)) || (quiet && !jsonOutput(c)) {
+			orders = append(orders, order)
+			return
+		}
+		if len(orders) > 0 {
+			printSeparator()
+		}
+		orders = append(orders, order)
+		printOrder(order)
+	})
+	if quiet && !jsonOutput(c) {
+		for _, order := range orders {
+			printOrder(order)
+		}
+	}
+	if err != nil && isInterrupted(err) && len(orders) > 0 {
+		summary := summarizeFills(orders)
+
+		if jsonOutput(c) {
+			printJSON(summary)
+		} else {
+			printSeparator()
+			printFillSummary(summary)
+		}
+	}
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if unsafe && jsonOutput(c) {
+		printJSON(orders)
+	}
+
+	return nil
+}
+
+// mid prints a single price with no labels, for capturing in scripts.
+func mid(c *cli.Context, ex exchange) error {
+	mkt := getMarket(c)
+	field := strings.ToLower(c.String("field"))
+
+	price, err := getPrice(ex, mkt, field)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	fmt.Fprintln(stdout, strconv.FormatFloat(price, 'f', -1, 64))
+
+	return nil
+}
+
+// mm quotes both sides of the market in the foreground until interrupted,
+// then cancels whatever quotes are left, whatever stopped it.
+func mm(c *cli.Context, ex exchange) error {
+	mkt := getMarket(c)
+	baseAmount := c.Float64("base-amt")
+	spreadBps := c.Float64("spread-bps")
+	repriceBps := c.Float64("reprice-bps")
+	maxPosition := c.Float64("max-position")
+
+	if baseAmount <= 0 {
+		err := errors.New(ERROR_INVALID_AMOUNT)
+		printError(err)
+		return err
+	}
+
+	if spreadBps <= 0 {
+		err := errors.New(ERROR_INVALID_SPREAD)
+		printError(err)
+		return err
+	}
+
+	if repriceBps <= 0 {
+		err := errors.New(ERROR_INVALID_REPRICE)
+		printError(err)
+		return err
+	}
+
+	if maxPosition <= 0 {
+		err := errors.New(ERROR_INVALID_POSITION)
+		printError(err)
+		return err
+	}
+
+	if c.Int("interval") <= 0 {
+		err := errors.New(ERROR_INVALID_INTERVAL)
+		printError(err)
+		return err
+	}
+
+	prompt := fmt.Sprintf("Quote %v %s each side, %v bps wide, up to a position of %v?", baseAmount, mkt, spreadBps, maxPosition)
+
+	err := confirmOrder(c, prompt)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	stopMetrics, err := startMetrics(c.String("metrics-addr"))
+	if err != nil {
+		printError(err)
+		return err
+	}
+	defer stopMetrics()
+
+	// the first Ctrl-C stops the loop between updates, leaving the
+	// requests needed to cancel the quotes working
+	stop, release := holdInterrupt()
+	defer release()
+
+	defer startHeartbeat(c.Bool("require-heartbeat"))()
+
+	m := newMarketMaker(ex, mkt, baseAmount, spreadBps, repriceBps, maxPosition)
+	m.printUpdates = !jsonOutput(c)
+
+	interval := time.Duration(c.Int("interval")) * time.Second
+
+quoting:
+	for {
+		err = m.update()
+		if err != nil {
+			recordError("mm")
+			break
+		}
+
+		select {
+		case <-stop:
+			break quoting
+		case <-time.After(interval):
+		}
+	}
+
+	if cancelErr := m.cancelAll(); cancelErr != nil {
+		printError(fmt.Errorf("%s: %v", ERROR_MM_CANCEL, cancelErr))
+		if err == nil {
+			err = cancelErr
+		}
+	}
+
+	if jsonOutput(c) {
+		printJSON(m.report)
+	} else if !quiet {
+		printSeparator()
+		printMmReport(m.report)
+	}
+
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	return nil
+}
+
+// oco places a take-profit limit and a stop-limit for the same amount and
+// stays in the foreground to cancel whichever is left once the other
+// fills. The stop goes first so the position is protected as soon as
+// possible; if the take-profit can't be placed the stop is cancelled.
+func oco(c *cli.Context, ex exchange) error {
+	mkt := getMarket(c)
+	side := c.String("side")
+	baseAmount := c.Float64("base-amt")
+
+	err := validateSide(side)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if baseAmount <= 0 {
+		err := errors.New(ERROR_INVALID_AMOUNT)
+		printError(err)
+		return err
+	}
+
+	if c.Float64("take-profit") <= 0 || c.Float64("stop") <= 0 || c.Float64("stop-limit") < 0 {
+		err := errors.New(ERROR_INVALID_PRICE)
+		printError(err)
+		return err
+	}
+
+	if c.Int("interval") <= 0 {
+		err := errors.New(ERROR_INVALID_INTERVAL)
+		printError(err)
+		return err
+	}
+
+	var prices []float64
+	for _, name := range []string{"take-profit", "stop", "stop-limit"} {
+		price := c.Float64(name)
+		if name == "stop-limit" && price == 0 {
+			price = prices[1]
+		}
+
+		price, err := getLimitPrice(mkt, price, c.Bool("strict"))
+		if err != nil {
+			printError(err)
+			return err
+		}
+		prices = append(prices, price)
+	}
+	takeProfit, stopPrice, stopLimit := prices[0], prices[1], prices[2]
+
+	btcAmount, err := getLimitAmount(mkt, side, 0, baseAmount, takeProfit, 0)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	// a sell bracket closes a long position, with the take-profit above the
+	// market and the stop below it; a buy bracket is the other way around
+	top, err := getTopOfBook(ex, mkt)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if (side == "sell" && !(stopPrice < top.Bid && top.Bid < takeProfit)) ||
+		(side == "buy" && !(takeProfit < top.Ask && top.Ask < stopPrice)) {
+		err := fmt.Errorf("%s: bid %v, ask %v", ERROR_INVALID_BRACKET, top.Bid, top.Ask)
+		printError(err)
+		return err
+	}
+
+	prompt := fmt.Sprintf("Place %s %v %s with take-profit @ %v and stop @ %v limit %v?",
+		strings.ToUpper(side), btcAmount, mkt, takeProfit, stopPrice, stopLimit)
+
+	err = confirmOrder(c, prompt)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	res := &ocoResult{}
+
+	res.Stop, err = ex.StopLimitOrder(mkt, newClientOrderId(), btcAmount, stopPrice, stopLimit, side)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	res.TakeProfit, err = ex.NewOrder(mkt, newClientOrderId(), btcAmount, takeProfit, side, nil)
+	if err != nil {
+		printError(err)
+		if err := cancelSurvivor(ex, &res.Stop); err != nil {
+			printError(err)
+		}
+		return err
+	}
+
+	if !jsonOutput(c) {
+		printOrder(res.TakeProfit)
+		printSeparator()
+		printOrder(res.Stop)
+		printSeparator()
+	}
+
+	err = manageBracket(c, ex, res)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if jsonOutput(c) {
+		printJSON(res)
+		return nil
+	}
+
+	printOrder(res.TakeProfit)
+	printSeparator()
+	printOrder(res.Stop)
+
+	return nil
+}
+
+func pnl(c *cli.Context, ex exchange) error {
+	mkt := getMarket(c)
+
+	pastTrades, err := getAllTrades(ex, mkt, 0)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	report := computePnl(mkt, pastTrades)
+
+	if jsonOutput(c) {
+		printJSON(report)
+		return nil
+	}
+
+	w := newTabWriter()
+
+	fmt.Fprintf(w, "%s:\t%s\n", blue("RealizedPnl"), boldWhite(fmt.Sprintf("%.*f", precision, report.RealizedPnl)))
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("Fees"), precision, report.Fees)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("Position"), precision, report.Position)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("AvgCost"), precision, report.AvgCost)
+	fmt.Fprintf(w, "%s:\t%d\n", blue("Trades"), report.Trades)
+
+	if report.Unmatched > 0 {
+		fmt.Fprintf(w, "%s:\t%s\n", blue("UnmatchedSells"), red(fmt.Sprintf("%.*f", precision, report.Unmatched)))
+	}
+
+	w.Flush()
+
+	return nil
+}
+
+func portfolio(c *cli.Context, ex exchange) error {
+	quote := strings.ToLower(c.String("quote"))
+
+	var balances []gemini.FundBalance
+	err := withRetry(func() (err error) {
+		balances, err = ex.Balances()
+		return err
+	})
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	report, err := valuePortfolio(ex, balances, quote)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if jsonOutput(c) {
+		printJSON(report)
+		return nil
+	}
+
+	w := newTabWriter()
+
+	for _, h := range report.Holdings {
+		if !h.Priced {
+			fmt.Fprintf(w, "%s:\t%v\t%s\n", blue(h.Currency), h.Amount, red("unpriced"))
+			continue
+		}
+		fmt.Fprintf(w, "%s:\t%v\t@ %.*f\t%.2f %s\n", blue(h.Currency), h.Amount, precision, h.Price, h.Value, quote)
+	}
+
+	fmt.Fprintf(w, "%s:\t\t\t%s\n", blue("Total"), boldWhite(fmt.Sprintf("%.2f %s", report.Total, quote)))
+
+	w.Flush()
+
+	return nil
+}
+
+func repl(c *cli.Context) error {
+	return runRepl(c.App)
+}
+
+// replace moves a live order to a new price or amount. The exchange has no
+// cancel-replace, so the order is cancelled and placed again with its
+// original market, side and options. Without a new amount the replacement
+// is for whatever was left unfilled once the cancel went through.
+func replace(c *cli.Context, ex exchange) error {
+	txid := c.String("txid")
+	amount := c.Float64("amt")
+	baseAmount := c.Float64("base-amt")
+	price := c.Float64("price")
+
+	if txid == "" {
+		err := errors.New(ERROR_MISSING_TXID)
+		printError(err)
+		return err
+	}
+
+	if amount > 0 && baseAmount > 0 {
+		err := errors.New(ERROR_AMBIGUOUS_AMOUNT)
+		printError(err)
+		return err
+	}
+
+	if amount <= 0 && baseAmount <= 0 && price <= 0 {
+		err := errors.New(ERROR_NO_REPLACEMENT)
+		printError(err)
+		return err
+	}
+
+	var order gemini.Order
+	err := withRetry(func() (err error) {
+		order, err = ex.OrderStatus(txid)
+		return err
+	})
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if !order.IsLive {
+		err := fmt.Errorf("%s: %s", ERROR_ORDER_NOT_LIVE, txid)
+		printError(err)
+		return err
+	}
+
+	mkt := order.Symbol
+	side := order.Side
+
+	if price <= 0 {
+		price = order.Price
+	}
+
+	price, err = getLimitPrice(mkt, price, c.Bool("strict"))
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	keepAmount := amount <= 0 && baseAmount <= 0
+	if keepAmount {
+		baseAmount = order.RemainingAmount
+	}
+
+	btcAmount, err := getLimitAmount(mkt, side, amount, baseAmount, price, getFeeBps(c, true))
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if !c.Bool("force") {
+		err := checkDeviation(ex, mkt, side, price, c.Float64("max-deviation"))
+		if err != nil {
+			printError(err)
+			return err
+		}
+	}
+
+	prompt := fmt.Sprintf("Replace %s with %s %v %s @ %v?", txid, strings.ToUpper(side), btcAmount, mkt, price)
+
+	err = confirmOrder(c, prompt)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if keepAmount {
+		btcAmount = 0
+	}
+
+	newOrder, _, err := replaceOrder(ex, order, getClientOrderId(c), btcAmount, price)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if jsonOutput(c) {
+		printJSON(newOrder)
+		return nil
+	}
+
+	printOrder(newOrder)
+	return nil
+}
+
+func spread(c *cli.Context, ex exchange) error {
+	top, err := getTopOfBook(ex, getMarket(c))
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if jsonOutput(c) {
+		printJSON(top)
+		return nil
+	}
+
+	w := newTabWriter()
+
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Bid"), boldWhite(fmt.Sprintf("%.*f", precision, top.Bid)))
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Ask"), boldWhite(fmt.Sprintf("%.*f", precision, top.Ask)))
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("Spread"), precision, top.Spread)
+	fmt.Fprintf(w, "%s:\t%.2f\n", blue("SpreadBps"), top.SpreadBps)
+
+	w.Flush()
+
+	return nil
+}
+
+// stats summarizes the market's public trades over the last --window.
+func stats(c *cli.Context) error {
+	mkt := getMarket(c)
+	window := c.Duration("window")
+
+	if window <= 0 {
+		err := errors.New(ERROR_INVALID_WINDOW)
+		printError(err)
+		return err
+	}
+
+	from := time.Now().Add(-window).UnixNano() / int64(time.Millisecond)
+
+	trades, err := getMarketTrades(mkt, from)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	summary := summarizeMarketTrades(mkt, from, trades)
+
+	if jsonOutput(c) {
+		printJSON(summary)
+		return nil
+	}
+
+	w := newTabWriter()
+
+	fmt.Fprintf(w, "%s:\t%s\n", blue("From"), formatTimestamp(summary.From, time.Millisecond))
+	fmt.Fprintf(w, "%s:\t%d\n", blue("Count"), summary.Count)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("MinPrice"), precision, summary.MinPrice)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("MaxPrice"), precision, summary.MaxPrice)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("AvgPrice"), precision, summary.AvgPrice)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Vwap"), boldWhite(fmt.Sprintf("%.*f", precision, summary.Vwap)))
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("Volume"), precision, summary.Volume)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("BuyVolume"), precision, summary.BuyVolume)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("SellVolume"), precision, summary.SellVolume)
+
+	w.Flush()
+
+	return nil
+}
+
+func status(c *cli.Context, ex exchange) error {
+	return eachTxid(c, func(txid string) (gemini.Order, error) {
+		var order gemini.Order
+		err := withRetry(func() (err error) {
+			order, err = ex.OrderStatus(txid)
+			return err
+		})
+		if err != nil || !c.Bool("wait") {
+			return order, err
+		}
+
+		return waitForOrder(c, ex, order)
+	})
+}
+
+func statusByClientId(c *cli.Context) error {
+	orders, err := getOrdersByClientId(c.String("client-order-id"))
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if jsonOutput(c) {
+		printJSON(orders)
+		return nil
+	}
+
+	for i, order := range orders {
+		if i > 0 {
+			printSeparator()
+		}
+		printOrder(order)
+	}
+
+	return nil
+}
+
+func streamOrderBook(c *cli.Context) error {
+	mkt := getMarket(c)
+	lim := c.Int("lim")
+	jsonOut := jsonOutput(c)
+
+	book := newStreamBook()
+	lines := 0
+
+	if !jsonOut {
+		terminalControl(CURSOR_HIDE)
+		defer terminalControl(CURSOR_SHOW)
+	}
+
+	connect := func() {
+		book = newStreamBook()
+	}
+
+	handle := func(raw []byte) error {
+		var msg marketDataMessage
+		err := json.Unmarshal(raw, &msg)
+		if err != nil {
+			return err
+		}
+
+		if msg.Type != "update" {
+			return nil
+		}
+
+		if jsonOut {
+			fmt.Fprintln(stdout, string(raw))
+			return nil
+		}
+
+		book.apply(msg)
+		top := book.top(lim)
+
+		if lines > 0 {
+			clearLines(lines)
+		}
+		printBook(top, false)
+		lines = len(top.Asks) + len(top.Bids) + 1
+
+		return nil
+	}
+
+	streamUrl := getStreamUrl("/v1/marketdata/" + mkt)
+
+	header := func() (http.Header, error) {
+		return nil, nil
+	}
+
+	err := stream(streamUrl, header, connect, handle)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	return nil
+}
+
+func streamOrders(c *cli.Context) error {
+	jsonOut := jsonOutput(c)
+
+	handle := func(raw []byte) error {
+		// acks and heartbeats are objects, order events come in arrays
+		if len(raw) == 0 || raw[0] != '[' {
+			return nil
+		}
+
+		var events []orderEvent
+		err := json.Unmarshal(raw, &events)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			switch event.Type {
+			case "accepted":
+				recordPlaced(event.Symbol, event.Side)
+			case "fill":
+				notifyFill(c, event.order())
+				if event.Fill != nil {
+					recordFill(event.Symbol, event.Side, event.Fill.Amount, event.Fill.Price)
+				}
+			case "rejected":
+				recordError("stream-orders")
+			}
+
+			if jsonOut {
+				printJSON(event)
+				continue
+			}
+
+			fmt.Fprintln(stdout, boldWhite(strings.ToUpper(event.Type)))
+			printOrder(event.order())
+			printSeparator()
+		}
+
+		return nil
+	}
+
+	path := "/v1/order/events"
+	query := url.Values{}
+	for _, eventType := range ORDER_EVENT_TYPES {
+		query.Add("eventTypeFilter", eventType)
+	}
+	if c.IsSet("mkt") || cfg.Market != "" {
+		query.Set("symbolFilter", getMarket(c))
+	}
+
+	header := func() (http.Header, error) {
+		return signedHeader(path, nil)
+	}
+
+	stopMetrics, err := startMetrics(c.String("metrics-addr"))
+	if err != nil {
+		printError(err)
+		return err
+	}
+	defer stopMetrics()
+
+	defer startHeartbeat(c.Bool("require-heartbeat"))()
+
+	err = stream(getStreamUrl(path+"?"+query.Encode()), header, func() {}, handle)
+	if err != nil {
+		recordError("stream-orders")
+		printError(err)
+		return err
+	}
+
+	return nil
+}
+
+func symbolsList(c *cli.Context, ex exchange) error {
+	if c.Bool("refresh") {
+		refreshSymbols = true
+		symbols = nil
+	}
+
+	symbols, err := getSymbols(ex)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if jsonOutput(c) {
+		printJSON(symbols)
+		return nil
+	}
+
+	for _, symbol := range symbols {
+		fmt.Fprintln(stdout, symbol)
+	}
+
+	return nil
+}
+
+// ticker prints the ticker of a market. Given several markets, as a comma
+// separated --mkt or as arguments, it fetches them concurrently and prints
+// a table, only failing when every market does.
+func ticker(c *cli.Context, ex exchange) error {
+	mkt := getMarket(c)
+
+	if markets := getMarkets(c); len(markets) > 1 {
+		if c.Bool("watch") {
+			err := errors.New(ERROR_WATCH_MARKETS)
+			printError(err)
+			return err
+		}
+		return tickers(c, ex, markets)
+	}
+
+	if c.Bool("watch") {
+		return watchTicker(c, ex, mkt)
+	}
+
+	var t gemini.Ticker
+	err := withRetry(func() (err error) {
+		t, err = ex.Ticker(mkt)
+		return err
+	})
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if jsonOutput(c) {
+		printJSON(t)
+		return nil
+	}
+
+	printTicker(t)
+
+	return nil
+}
+
+func tickers(c *cli.Context, ex exchange, markets []string) error {
+	list := getTickers(ex, markets)
+
+	var err error
+	failed := 0
+	for _, t := range list {
+		if t.Error != "" {
+			failed++
+			err = errors.New(t.Error)
+		}
+	}
+
+	if jsonOutput(c) {
+		printJSON(list)
+	} else {
+		printTickers(list)
+	}
+
+	if failed == len(list) {
+		return err
+	}
+	return nil
+}
+
+// top prints a one line summary of the top of the book, optionally
+// refreshed in place with the spread colored by whether it widened or
+// narrowed since the last refresh.
+func top(c *cli.Context, ex exchange) error {
+	mkt := getMarket(c)
+
+	interval := c.Int("interval")
+	if c.Bool("watch") && interval <= 0 {
+		err := errors.New(ERROR_INVALID_INTERVAL)
+		printError(err)
+		return err
+	}
+
+	// stop between refreshes rather than cancelling a request
+	stop, release := holdInterrupt()
+	defer release()
+
+	var tick <-chan time.Time
+	if c.Bool("watch") {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		tick = ticker.C
+
+		if !jsonOutput(c) {
+			terminalControl(CURSOR_HIDE)
+			defer terminalControl(CURSOR_SHOW)
+		}
+	}
+
+	inPlace := c.Bool("watch") && isTerminalOutput()
+
+	var last *topQuote
+
+	for {
+		quote, err := getTopQuote(ex, mkt)
+		if err != nil {
+			printError(err)
+			return err
+		}
+
+		if jsonOutput(c) {
+			printJSON(quote)
+		} else {
+			printTopQuote(quote, last, inPlace)
+		}
+		last = quote
+
+		if !c.Bool("watch") {
+			return nil
+		}
+
+		select {
+		case <-stop:
+			if inPlace {
+				fmt.Fprintln(stdout, "")
+			}
+			return nil
+		case <-tick:
+		}
+	}
+}
+
+func trades(c *cli.Context, ex exchange) error {
+	mkt := getMarket(c)
+	lim := c.Int("lim")
+	timestamp := c.Int64("time")
+	date := c.String("date")
+
+	if date != "" {
+		t, err := getTimeFromDate(date, c.String("tz"))
+		if err != nil {
+			printError(err)
+			return err
+		}
+
+		timestamp = t
+	}
+
+	from, to, err := getDateRange(c.String("from"), c.String("to"), c.String("tz"))
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if from > timestamp {
+		timestamp = from
+	}
+
+	var pastTrades []gemini.Trade
+	if c.Bool("all") {
+		pastTrades, err = getAllTrades(ex, mkt, timestamp)
+	} else {
+		err = withRetry(func() (err error) {
+			pastTrades, err = ex.PastTrades(mkt, lim, timestamp)
+			return err
+		})
+	}
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	pastTrades = filterTrades(pastTrades, from, to)
+
+	if c.Bool("summary-only") {
+		summary := summarizeTrades(pastTrades)
+
+		switch {
+		case c.Bool("csv"):
+			err = printTradeSummaryCSV(summary, c.String("fields"))
+		case jsonOutput(c):
+			printJSON(summary)
+		case c.Bool("table"):
+			err = printTradeSummaryTable(summary, c.String("fields"))
+		default:
+			printTradeSummary(summary)
+		}
+
+		if err != nil {
+			printError(err)
+		}
+		return err
+	}
+
+	if c.Bool("csv") {
+		err := printTradesCSV(pastTrades, c.String("fields"))
+		if err != nil {
+			printError(err)
+		}
+		return err
+	}
+
+	if jsonOutput(c) {
+		printJSON(pastTrades)
+		return nil
+	}
+
+	if c.Bool("table") {
+		err := printTradesTable(pastTrades, c.String("fields"))
+		if err != nil {
+			printError(err)
+			return err
+		}
+	} else {
+		for idx, trade := range pastTrades {
+			printTrade(trade)
+			if idx < len(pastTrades)-1 {
+				printSeparator()
+			}
+		}
+	}
+
+	if len(pastTrades) > 1 {
+		printSeparator()
+		printTradeSummary(summarizeTrades(pastTrades))
+	}
+
+	return nil
+}
+
+// trailingStop follows the market in the foreground, moving the trigger
+// along with the best price seen, and fills a market order once the price
+// falls back to it. A sell trails the bid up from below, a buy trails the
+// ask down from above. Nothing is placed on the exchange until then.
+func trailingStop(c *cli.Context, ex exchange) error {
+	mkt := getMarket(c)
+	side := c.String("side")
+	baseAmount := c.Float64("base-amt")
+
+	err := validateSide(side)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if baseAmount <= 0 {
+		err := errors.New(ERROR_INVALID_AMOUNT)
+		printError(err)
+		return err
+	}
+
+	distance, pct, err := parseTrail(c.String("trail"))
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if c.Int("interval") <= 0 {
+		err := errors.New(ERROR_INVALID_INTERVAL)
+		printError(err)
+		return err
+	}
+
+	if c.Int("max-requotes") <= 0 {
+		err := errors.New(ERROR_INVALID_REQUOTES)
+		printError(err)
+		return err
+	}
+
+	prompt := fmt.Sprintf("Trail %s %v %s by %s?", strings.ToUpper(side), baseAmount, mkt, c.String("trail"))
+
+	err = confirmOrder(c, prompt)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	// Ctrl-C stops the tracking, or lets the order in flight finish
+	stop, release := holdInterrupt()
+	defer release()
+
+	report := trailReport{Market: mkt, Side: side}
+	interval := time.Duration(c.Int("interval")) * time.Second
+
+	for {
+		var ticker gemini.Ticker
+		err := withRetry(func() (err error) {
+			ticker, err = ex.Ticker(mkt)
+			return err
+		})
+		if err != nil {
+			printError(err)
+			return err
+		}
+
+		price := ticker.Bid
+		if side == "buy" {
+			price = ticker.Ask
+		}
+
+		if price > 0 {
+			if report.Peak == 0 || (side == "sell" && price > report.Peak) || (side == "buy" && price < report.Peak) {
+				report.Peak = price
+				report.Trigger = trailTrigger(side, price, distance, pct)
+
+				if !jsonOutput(c) {
+					fmt.Fprintf(stdout, "%s: %v, %s: %s\n", blue("Peak"), report.Peak, blue("Trigger"), boldWhite(fmt.Sprintf("%.*f", precision, report.Trigger)))
+				}
+			}
+
+			if (side == "sell" && price <= report.Trigger) || (side == "buy" && price >= report.Trigger) {
+				report.Price = price
+				break
+			}
+		}
+
+		select {
+		case <-stop:
+			err := errors.New(ERROR_INTERRUPTED)
+			printError(err)
+			return err
+		case <-time.After(interval):
+		}
+	}
+
+	if !jsonOutput(c) {
+		fmt.Fprintf(stdout, "%s: %v\n", blue("Triggered"), report.Price)
+		printSeparator()
+	}
+
+	unsafe := c.Bool("unsafe") && !c.Bool("no-retry")
+
+	err = fillMarketOrder(ex, mkt, side, getClientOrderId(c), "immediate-or-cancel", 0, baseAmount, unsafe, c.Int("max-requotes"), stop, func(order gemini.Order) {
+		if !jsonOutput(c) {
+			if len(report.Orders) > 0 {
+				printSeparator()
+			}
+			printOrder(order)
+		}
+		report.Orders = append(report.Orders, order)
+	})
+
+	report.fillSummary = summarizeFills(report.Orders)
+
+	if jsonOutput(c) {
+		printJSON(report)
+	} else if len(report.Orders) > 1 {
+		printSeparator()
+		printFillSummary(report.fillSummary)
+	}
+
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	return nil
+}
+
+// transfers lists deposits and withdrawals, optionally for one currency.
+// The currency is filtered after fetching, so a page can come back with
+// fewer than lim transfers.
+func transfers(c *cli.Context) error {
+	currency := c.String("currency")
+	lim := c.Int("lim")
+	timestamp := c.Int64("time")
+
+	var list []transfer
+	var err error
+	if c.Bool("all") {
+		list, err = getAllTransfers(timestamp)
+	} else {
+		list, err = getTransfers(lim, timestamp)
+	}
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	list = filterTransfers(list, currency)
+
+	if c.Bool("csv") {
+		err := printTransfersCSV(list, c.String("fields"))
+		if err != nil {
+			printError(err)
+		}
+		return err
+	}
+
+	if jsonOutput(c) {
+		printJSON(list)
+		return nil
+	}
+
+	if c.Bool("table") {
+		err := printTransfersTable(list, c.String("fields"))
+		if err != nil {
+			printError(err)
+		}
+		return err
+	}
+
+	for idx, t := range list {
+		printTransfer(t)
+		if idx < len(list)-1 {
+			printSeparator()
+		}
+	}
+
+	return nil
+}
+
+// twap works an order in equal immediate-or-cancel slices spread evenly
+// over --duration. Whatever a slice leaves unfilled is carried into the
+// next one, and slices are skipped while the price is beyond
+// --max-slippage from where it started. Each slice is tagged with the
+// client order id and its slice number, e.g. <id>-3.
+func twap(c *cli.Context, ex exchange) error {
+	amount := c.Float64("amt")
+	baseAmount := c.Float64("base-amt")
+	mkt := getMarket(c)
+	side := c.String("side")
+	slices := c.Int("slices")
+	duration := c.Duration("duration")
+	maxSlippage := c.Float64("max-slippage")
+
+	if amount <= 0.0 && baseAmount <= 0.0 {
+		err := errors.New(ERROR_INVALID_AMOUNT)
+		printError(err)
+		return err
+	}
+
+	if slices <= 0 {
+		err := errors.New(ERROR_INVALID_SLICES)
+		printError(err)
+		return err
+	}
+
+	if duration <= 0 {
+		err := errors.New(ERROR_INVALID_DURATION)
+		printError(err)
+		return err
+	}
+
+	feeRatio := getFeeRatio(getFeeBps(c, false))
+
+	if side == "buy" {
+		amount -= amount * feeRatio
+	} else {
+		amount += amount * feeRatio
+	}
+
+	prompt := fmt.Sprintf("Place %s %v %s @ market in %d slices over %v?", strings.ToUpper(side), baseAmount, mkt, slices, duration)
+	if amount > 0 {
+		prompt = fmt.Sprintf("Place %s %v worth of %s @ market in %d slices over %v?", strings.ToUpper(side), round(amount, 2), mkt, slices, duration)
+	}
+
+	err := confirmOrder(c, prompt)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	start, err := getTopOfBook(ex, mkt)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	interval := duration / time.Duration(slices)
+	clientOrderId := getClientOrderId(c)
+
+	report := twapReport{Slices: slices, Orders: make([]gemini.Order, 0, slices)}
+
+	stopMetrics, err := startMetrics(c.String("metrics-addr"))
+	if err != nil {
+		printError(err)
+		return err
+	}
+	defer stopMetrics()
+
+	// let the slice in flight finish on Ctrl-C rather than abort it
+	stop, release := holdInterrupt()
+	defer release()
+
+	defer startHeartbeat(c.Bool("require-heartbeat"))()
+
+	executedBase := 0.0
+	executedQuote := 0.0
+
+	for i := 1; i <= slices; i++ {
+		if i > 1 {
+			select {
+			case <-stop:
+				err = errors.New(ERROR_INTERRUPTED)
+			case <-time.After(interval):
+			}
+			if err != nil {
+				break
+			}
+		}
+
+		var entry *gemini.BookEntry
+		entry, err = getOrderBookEntry(ex, mkt, side)
+		if err != nil {
+			break
+		}
+
+		recordPrice(mkt, entry.Price)
+
+		slippage := (entry.Price - start.Mid) / start.Mid * 10000
+		if side == "sell" {
+			slippage = -slippage
+		}
+
+		if maxSlippage > 0 && slippage > maxSlippage {
+			report.Skipped++
+			if !jsonOutput(c) {
+				fmt.Fprintf(stdout, "%s %d/%d: %s\n", blue("Slice"), i, slices, red(fmt.Sprintf("skipped, %.2f bps from start", slippage)))
+			}
+			continue
+		}
+
+		// size each slice to catch up with an even schedule
+		sliceAmt := 0.0
+		sliceBase := 0.0
+		if amount > 0 {
+			sliceAmt = amount*float64(i)/float64(slices) - executedQuote
+		} else {
+			sliceBase = baseAmount*float64(i)/float64(slices) - executedBase
+		}
+
+		sliceId := fmt.Sprintf("%s-%d", clientOrderId, i)
+		err = fillMarketOrder(ex, mkt, side, sliceId, "immediate-or-cancel", sliceAmt, sliceBase, false, 1, stop, func(order gemini.Order) {
+			executedBase += order.ExecutedAmount
+			executedQuote += order.ExecutedAmount * order.AvgExecutionPrice
+			report.Orders = append(report.Orders, order)
+			recordOrder(mkt, order)
+
+			if !jsonOutput(c) {
+				fmt.Fprintf(stdout, "%s %d/%d: %s executed %v @ %v\n", blue("Slice"), i, slices, boldWhite(order.OrderId), order.ExecutedAmount, order.AvgExecutionPrice)
+			}
+		})
+
+		// a slice too small to place is carried into the next one
+		if err != nil && strings.HasPrefix(err.Error(), ERROR_BELOW_MIN_ORDER) {
+			if !jsonOutput(c) {
+				fmt.Fprintf(stdout, "%s %d/%d: %s\n", blue("Slice"), i, slices, "carried, below the minimum order size")
+			}
+			err = nil
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	report.fillSummary = summarizeFills(report.Orders)
+	if amount > 0 {
+		report.Remaining = amount - report.QuoteAmount
+	} else {
+		report.Remaining = baseAmount - report.BaseAmount
+	}
+
+	if jsonOutput(c) {
+		printJSON(report)
+	} else {
+		printSeparator()
+		printFillSummary(report.fillSummary)
+		fmt.Fprintf(stdout, "%s: %.*f\n", blue("Remaining"), precision, report.Remaining)
+	}
+
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if report.Skipped > 0 {
+		err := fmt.Errorf("%s: %d of %d slices skipped", ERROR_MAX_SLIPPAGE, report.Skipped, slices)
+		printError(err)
+		return err
+	}
+
+	return nil
+}
+
+// watchTicker re-queries the ticker every interval until interrupted,
+// redrawing in place or, in JSON mode, printing one object per line.
+func watchTicker(c *cli.Context, ex exchange, mkt string) error {
+	interval := c.Int("interval")
+	if interval <= 0 {
+		err := errors.New(ERROR_INVALID_INTERVAL)
+		printError(err)
+		return err
+	}
+
+	// stop between redraws so the cursor is restored
+	stop, release := holdInterrupt()
+	defer release()
+
+	tick := time.NewTicker(time.Duration(interval) * time.Second)
+	defer tick.Stop()
+
+	if !jsonOutput(c) {
+		terminalControl(CURSOR_HIDE)
+		defer terminalControl(CURSOR_SHOW)
+	}
+
+	drawn := false
+
+	for {
+		var t gemini.Ticker
+		err := withRetry(func() (err error) {
+			t, err = ex.Ticker(mkt)
+			return err
+		})
+		if err != nil {
+			printError(err)
+			return err
+		}
+
+		if jsonOutput(c) {
+			printJSON(t)
+		} else {
+			if drawn {
+				clearLines(TICKER_LINES)
+			}
+			printTicker(t)
+			drawn = true
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+// version prints the build info along with the Go version and platform,
+// for bug reports.
+func version(c *cli.Context) error {
+	info := getVersionInfo()
+
+	if jsonOutput(c) {
+		printJSON(info)
+		return nil
+	}
+
+	w := newTabWriter()
+
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Version"), boldWhite(info.Version))
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Commit"), info.Commit)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Date"), info.Date)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("GoVersion"), info.GoVersion)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Platform"), info.Platform)
+
+	w.Flush()
+
+	return nil
+}
+
+// vwap walks one side of the book for --base-amt and reports the
+// volume-weighted price, the levels and depth it takes, and any shortfall
+// when the book is too thin.
+func vwap(c *cli.Context, ex exchange) error {
+	baseAmount := c.Float64("base-amt")
+	mkt := getMarket(c)
+	side := c.String("side")
+
+	if baseAmount <= 0.0 {
+		err := errors.New(ERROR_INVALID_AMOUNT)
+		printError(err)
+		return err
+	}
+
+	entries, err := getOrderBookSide(ex, mkt, side, 0)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	fill := walkBook(entries, 0, baseAmount)
+
+	res := vwapResult{
+		Vwap:        fill.AvgPrice,
+		BaseAmount:  fill.BaseAmount,
+		QuoteAmount: fill.QuoteAmount,
+		Levels:      fill.Levels,
+		Shortfall:   fill.Shortfall,
+	}
+	for _, entry := range entries {
+		res.BookDepth += entry.Amount
+	}
+
+	if jsonOutput(c) {
+		printJSON(res)
+		return nil
+	}
+
+	w := newTabWriter()
+
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Vwap"), boldWhite(fmt.Sprintf("%.*f", precision, res.Vwap)))
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("BaseAmount"), precision, res.BaseAmount)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("QuoteAmount"), precision, res.QuoteAmount)
+	fmt.Fprintf(w, "%s:\t%d of %d\n", blue("Levels"), res.Levels, len(entries))
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("BookDepth"), precision, res.BookDepth)
+
+	if res.Shortfall > 0 {
+		fmt.Fprintf(w, "%s:\t%s\n", blue("Shortfall"), red(fmt.Sprintf("%.*f", precision, res.Shortfall)))
+	}
+
+	w.Flush()
+
+	return nil
+}
+
+func withdraw(c *cli.Context, ex exchange) error {
+	currency := c.String("currency")
+	address := c.String("address")
+	amount := c.Float64("amt")
+
+	if currency == "" {
+		err := errors.New(ERROR_INVALID_CURRENCY)
+		printError(err)
+		return err
+	}
+
+	if address == "" {
+		err := errors.New(ERROR_INVALID_ADDRESS)
+		printError(err)
+		return err
+	}
+
+	if amount <= 0.0 {
+		err := errors.New(ERROR_INVALID_AMOUNT)
+		printError(err)
+		return err
+	}
+
+	if !c.Bool("yes") {
+		prompt := fmt.Sprintf("Withdraw %.8f %s to %s?", amount, currency, address)
+
+		err := confirm(prompt)
+		if err != nil {
+			printError(err)
+			return err
+		}
+	}
+
+	res, err := ex.WithdrawFunds(currency, address, amount)
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if jsonOutput(c) {
+		printJSON(res)
+		return nil
+	}
+
+	w := newTabWriter()
+
+	fmt.Fprintf(w, "%s:\t%s\n", blue("TxHash"), boldWhite(res.TxHash))
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Address"), res.Address)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("Amount"), precision, res.Amount)
+
+	w.Flush()
+
 	return nil
 }
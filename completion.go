@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+const bashCompletion = `#! /bin/bash
+
+_%[1]s_complete() {
+  local cur opts
+  COMPREPLY=()
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  if [[ "$cur" == "-"* ]]; then
+    opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} ${cur} --generate-bash-completion )
+  else
+    opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} --generate-bash-completion )
+  fi
+  COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+  return 0
+}
+
+complete -o bashdefault -o default -o nospace -F _%[1]s_complete %[2]s
+`
+
+const zshCompletion = `#compdef %[2]s
+
+_%[1]s_complete() {
+  local -a opts
+  local cur
+  cur=${words[-1]}
+  if [[ "$cur" == "-"* ]]; then
+    opts=("${(@f)$(_CLI_ZSH_AUTOCOMPLETE_HACK=1 ${words[@]:0:#words[@]-1} ${cur} --generate-bash-completion)}")
+  else
+    opts=("${(@f)$(_CLI_ZSH_AUTOCOMPLETE_HACK=1 ${words[@]:0:#words[@]-1} --generate-bash-completion)}")
+  fi
+
+  if [[ "${opts[1]}" != "" ]]; then
+    _describe 'values' opts
+  else
+    _files
+  fi
+}
+
+compdef _%[1]s_complete %[2]s
+`
+
+const fishCompletion = `function __%[1]s_complete
+    set -l args (commandline -opc)
+    set -l cur (commandline -ct)
+    if string match -q -- '-*' $cur
+        $args $cur --generate-bash-completion
+    else
+        $args --generate-bash-completion
+    end
+end
+
+complete -c %[2]s -f -a '(__%[1]s_complete)'
+`
+
+// COMPLETION_SCRIPTS maps a shell to its completion script. Each script
+// calls back into the binary with --generate-bash-completion.
+var COMPLETION_SCRIPTS = map[string]string{
+	"bash": bashCompletion,
+	"fish": fishCompletion,
+	"zsh":  zshCompletion,
+}
+
+// completeCommand completes market symbols after --mkt, or as the
+// positional arguments of commands that take them, and falls back to the
+// default flag completion otherwise.
+func completeCommand(c *cli.Context) {
+	cmd := c.Command
+
+	lastArg := ""
+	if len(os.Args) > 2 {
+		lastArg = os.Args[len(os.Args)-2]
+	}
+
+	positional := (c.NArg() == 0 && strings.HasSuffix(cmd.UsageText, "[mkt]")) ||
+		strings.HasSuffix(cmd.UsageText, "[mkt...]")
+
+	if lastArg == "--mkt" || lastArg == "-m" ||
+		(!strings.HasPrefix(lastArg, "-") && positional) {
+		completeMarkets(c)
+		return
+	}
+
+	cli.DefaultCompleteWithFlags(&cmd)(c)
+}
+
+// completeMarkets prints the exchange's symbols, one per line. beforeApp
+// does not run during completion so a client without keys is created here,
+// and any error prints nothing rather than breaking the shell.
+func completeMarkets(c *cli.Context) {
+	ex, ok := c.App.Metadata["exchange"].(exchange)
+	if !ok {
+		requestTimeout = COMPLETION_TIMEOUT
+		http.DefaultTransport = &contextTransport{http.DefaultTransport}
+		ex = newApiExchange(c.GlobalBool("live"), "", "")
+		gemini_api_url = getApiUrl(c.GlobalBool("live"))
+	}
+
+	symbols, err := getSymbols(ex)
+	if err != nil {
+		return
+	}
+
+	for _, symbol := range symbols {
+		fmt.Fprintln(c.App.Writer, symbol)
+	}
+}
+
+// completionScript returns the completion script for shell with the
+// binary's name filled in.
+func completionScript(shell, name string) (string, bool) {
+	script, ok := COMPLETION_SCRIPTS[shell]
+	if !ok {
+		return "", false
+	}
+
+	ident := strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, name)
+
+	return fmt.Sprintf(script, ident, name), true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/jsgoyette/gemini"
+)
+
+// exchange is the part of the gemini package the commands use, plus the
+// orders it doesn't place. apiExchange is the real one; a fake can be
+// passed to the commands in its place to run them without talking to the
+// exchange.
+type exchange interface {
+	ActiveOrders() ([]gemini.Order, error)
+	Auction(symbol string) (gemini.Auction, error)
+	Balances() ([]gemini.FundBalance, error)
+	CancelAll() (gemini.CancelResult, error)
+	CancelOrder(orderId string) (gemini.Order, error)
+	NewDepositAddress(currency, label string) (gemini.DepositAddressResult, error)
+	NewOrder(symbol, clientOrderId string, amount, price float64, side string, options []string) (gemini.Order, error)
+	OrderBook(symbol string, limitBids, limitAsks int) (gemini.Book, error)
+	OrderStatus(orderId string) (gemini.Order, error)
+	PastTrades(symbol string, limitTrades int, timestamp int64) ([]gemini.Trade, error)
+	StopLimitOrder(symbol, clientOrderId string, amount, stopPrice, price float64, side string) (gemini.Order, error)
+	Symbols() ([]string, error)
+	Ticker(symbol string) (gemini.Ticker, error)
+	WithdrawFunds(currency, address string, amount float64) (gemini.WithdrawFundsResult, error)
+}
+
+// apiExchange is the exchange itself, through the gemini package.
+type apiExchange struct {
+	*gemini.Api
+}
+
+var _ exchange = (*apiExchange)(nil)
+
+// newApiExchange returns a client for the live or sandbox exchange.
+func newApiExchange(live bool, key, secret string) *apiExchange {
+	return &apiExchange{gemini.New(live, key, secret)}
+}
+
+// StopLimitOrder places a stop-limit order. The gemini package only places
+// plain limit orders, so this goes to the order endpoint directly;
+// stop-limit orders don't take execution options.
+func (a *apiExchange) StopLimitOrder(symbol, clientOrderId string, amount, stopPrice, price float64, side string) (gemini.Order, error) {
+	params := map[string]interface{}{
+		"client_order_id": clientOrderId,
+		"symbol":          symbol,
+		"amount":          strconv.FormatFloat(amount, 'f', -1, 64),
+		"price":           strconv.FormatFloat(price, 'f', -1, 64),
+		"stop_price":      strconv.FormatFloat(stopPrice, 'f', -1, 64),
+		"side":            side,
+		"type":            "exchange stop limit",
+	}
+
+	var order gemini.Order
+	err := privateRequest("/v1/order/new", params, &order)
+
+	return order, err
+}
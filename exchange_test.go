@@ -0,0 +1,92 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/jsgoyette/gemini"
+)
+
+// fakeExchange fills orders against a fixed book, taking out what each
+// order fills so the next one is quoted off what's left. Methods it
+// doesn't override panic through the nil exchange.
+type fakeExchange struct {
+	exchange
+
+	book   gemini.Book
+	orders []gemini.Order
+}
+
+func (f *fakeExchange) OrderBook(symbol string, limitBids, limitAsks int) (gemini.Book, error) {
+	book := gemini.Book{Bids: f.book.Bids, Asks: f.book.Asks}
+	if limitBids > 0 && len(book.Bids) > limitBids {
+		book.Bids = book.Bids[:limitBids]
+	}
+	if limitAsks > 0 && len(book.Asks) > limitAsks {
+		book.Asks = book.Asks[:limitAsks]
+	}
+	return book, nil
+}
+
+// NewOrder fills as much of amount as the levels at price or better hold,
+// at the price of each level, and leaves the rest unfilled.
+func (f *fakeExchange) NewOrder(symbol, clientOrderId string, amount, price float64, side string, options []string) (gemini.Order, error) {
+	levels := &f.book.Asks
+	crosses := func(p float64) bool { return p <= price }
+	if side == "sell" {
+		levels = &f.book.Bids
+		crosses = func(p float64) bool { return p >= price }
+	}
+
+	executed, notional := 0.0, 0.0
+	for len(*levels) > 0 && executed < amount && crosses((*levels)[0].Price) {
+		level := &(*levels)[0]
+
+		fill := math.Min(level.Amount, amount-executed)
+		executed += fill
+		notional += fill * level.Price
+
+		level.Amount -= fill
+		if level.Amount <= 0 {
+			*levels = (*levels)[1:]
+		}
+	}
+
+	order := gemini.Order{
+		OrderId:         strconv.Itoa(len(f.orders) + 1),
+		ClientOrderId:   clientOrderId,
+		Symbol:          symbol,
+		Price:           price,
+		Side:            side,
+		Options:         options,
+		OriginalAmount:  amount,
+		ExecutedAmount:  executed,
+		RemainingAmount: amount - executed,
+	}
+	if executed > 0 {
+		order.AvgExecutionPrice = notional / executed
+	}
+
+	f.orders = append(f.orders, order)
+
+	return order, nil
+}
+
+// stubSymbolDetails serves details from the symbol cache for the rest of
+// the test, without reading the cache on disk or asking the exchange.
+func stubSymbolDetails(t *testing.T, details ...*symbolDetails) {
+	t.Helper()
+
+	symbolCacheOnce.Do(func() {})
+
+	for _, d := range details {
+		symbolDetailsCache[d.Symbol] = d
+	}
+
+	t.Cleanup(func() {
+		for _, d := range details {
+			delete(symbolDetailsCache, d.Symbol)
+		}
+	})
+}
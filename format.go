@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/jsgoyette/gemini"
+)
+
+// FORMAT_TYPES are the values each command hands to --format, used to list
+// the available fields in the command's help.
+var FORMAT_TYPES = map[string]interface{}{
+	"account":             accountInfo{},
+	"active":              gemini.Order{},
+	"alert":               alertResult{},
+	"arb":                 arbCheck{},
+	"auction":             gemini.Auction{},
+	"backtest":            backtestReport{},
+	"balances":            gemini.FundBalance{},
+	"book":                gemini.Book{},
+	"cancel":              gemini.Order{},
+	"cancel-all":          gemini.CancelResult{},
+	"cancel-by-client-id": gemini.CancelResult{},
+	"cancel-matching":     cancelSummary{},
+	"candles":             candle{},
+	"convert":             conversion{},
+	"deposit-address":     depositAddressResult{},
+	"estimate":            bookFill{},
+	"fees":                notionalVolume{},
+	"heartbeat":           heartbeatResult{},
+	"limit":               gemini.Order{},
+	"market":              gemini.Order{},
+	"mm":                  mmReport{},
+	"pnl":                 pnlReport{},
+	"portfolio":           portfolioReport{},
+	"replace":             gemini.Order{},
+	"spread":              topOfBook{},
+	"stats":               tradeStats{},
+	"status":              gemini.Order{},
+	"status-by-client-id": gemini.Order{},
+	"stream-orders":       orderEvent{},
+	"ticker":              gemini.Ticker{},
+	"top":                 topQuote{},
+	"trades":              gemini.Trade{},
+	"trailing-stop":       trailReport{},
+	"transfers":           transfer{},
+	"twap":                twapReport{},
+	"version":             versionInfo{},
+	"vwap":                vwapResult{},
+	"withdraw":            gemini.WithdrawFundsResult{},
+}
+
+// parseFormat parses the --format template. A newline is added when the
+// template has none so that each result ends up on its own line.
+func parseFormat(format string) (*template.Template, error) {
+	if !strings.HasSuffix(format, "\n") {
+		format += "\n"
+	}
+
+	tmpl, err := template.New("format").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ERROR_INVALID_FORMAT, err)
+	}
+
+	return tmpl, nil
+}
+
+// formatFields lists the exported fields of v, including those promoted
+// from embedded structs.
+func formatFields(v interface{}) []string {
+	var fields []string
+
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, formatFields(reflect.Zero(f.Type).Interface())...)
+			continue
+		}
+		if f.PkgPath == "" {
+			fields = append(fields, "."+f.Name)
+		}
+	}
+
+	return fields
+}
+
+// printFormat executes outputFormat against v, once per element when v is
+// a slice.
+func printFormat(v interface{}) {
+	rv := reflect.ValueOf(v)
+
+	if rv.Kind() != reflect.Slice {
+		if err := outputFormat.Execute(stdout, v); err != nil {
+			printError(err)
+		}
+		return
+	}
+
+	for i := 0; i < rv.Len(); i++ {
+		if err := outputFormat.Execute(stdout, rv.Index(i).Interface()); err != nil {
+			printError(err)
+			return
+		}
+	}
+}
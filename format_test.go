@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/jsgoyette/gemini"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// fixtureTime is when the order and trade fixtures were placed. Order ages
+// are measured from an hour and a half later.
+var fixtureTime = time.Date(2026, 3, 8, 7, 0, 0, 0, time.UTC)
+
+var (
+	fixtureOrders = []gemini.Order{
+		{
+			OrderId:         "1001",
+			ClientOrderId:   "a4b1c9d0-5e6f-4a7b-8c9d-0e1f2a3b4c5d",
+			Symbol:          "btcusd",
+			Exchange:        "gemini",
+			Price:           64250.5,
+			Side:            "buy",
+			Type:            "exchange limit",
+			Options:         []string{"maker-or-cancel"},
+			Timestamp:       fixtureTime.Unix(),
+			IsLive:          true,
+			OriginalAmount:  0.25,
+			RemainingAmount: 0.25,
+		},
+		{
+			OrderId:           "1002",
+			Symbol:            "ethusd",
+			Exchange:          "gemini",
+			Price:             3120,
+			AvgExecutionPrice: 3119.25,
+			Side:              "sell",
+			Type:              "exchange limit",
+			Options:           []string{"immediate-or-cancel"},
+			Timestamp:         fixtureTime.Add(-26 * time.Hour).Unix(),
+			IsCancelled:       true,
+			OriginalAmount:    2,
+			ExecutedAmount:    1.5,
+			RemainingAmount:   0.5,
+		},
+	}
+
+	fixtureTrades = []gemini.Trade{
+		{
+			OrderId:     "1002",
+			TradeId:     "5001",
+			Timestamp:   fixtureTime.Add(-26 * time.Hour).Unix(),
+			Type:        "Sell",
+			Exchange:    "gemini",
+			Price:       3119.25,
+			Amount:      1.5,
+			FeeCurrency: "USD",
+			FeeAmount:   4.6788,
+			Aggressor:   true,
+		},
+		{
+			OrderId:     "1003",
+			TradeId:     "5002",
+			Timestamp:   fixtureTime.Unix(),
+			Type:        "Buy",
+			Exchange:    "gemini",
+			Price:       64250.5,
+			Amount:      0.01,
+			FeeCurrency: "USD",
+			FeeAmount:   1.606263,
+		},
+	}
+
+	fixtureBook = gemini.Book{
+		Bids: []gemini.BookEntry{{Price: 64250.5, Amount: 0.5}, {Price: 64249, Amount: 1.25}, {Price: 64200, Amount: 10}},
+		Asks: []gemini.BookEntry{{Price: 64251, Amount: 0.75}, {Price: 64260.25, Amount: 2}},
+	}
+
+	fixtureBalances = []gemini.FundBalance{
+		{Currency: "BTC", Amount: 1.5, Available: 1.25, AvailableForWithdrawal: 1},
+		{Currency: "USD", Amount: 10000, Available: 8500.5, AvailableForWithdrawal: 8500.5},
+		{Currency: "XYZ", Amount: 3},
+	}
+
+	fixturePortfolio = &portfolioReport{
+		Quote: "usd",
+		Holdings: []holding{
+			{Currency: "btc", Amount: 1.5, Price: 64250.5, Value: 96375.75, Priced: true},
+			{Currency: "usd", Amount: 10000, Price: 1, Value: 10000, Priced: true},
+			{Currency: "xyz", Amount: 3},
+		},
+		Total: 106375.75,
+	}
+)
+
+// captureOutput runs print with color off, stdout going to a buffer and
+// the other output settings at their defaults, and returns what it wrote.
+func captureOutput(t *testing.T, print func() error) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	savedStdout, savedNow, noColor := stdout, now, color.NoColor
+	savedPrecision, pretty, quietOutput, utc := precision, prettyJSON, quiet, timeUTC
+	defer func() {
+		stdout, now, color.NoColor = savedStdout, savedNow, noColor
+		precision, prettyJSON, quiet, timeUTC = savedPrecision, pretty, quietOutput, utc
+	}()
+
+	stdout = &buf
+	color.NoColor = true
+	precision = 8
+	prettyJSON, quiet = false, false
+	timeUTC = true
+	now = func() time.Time { return fixtureTime.Add(90 * time.Minute) }
+
+	err := print()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.String()
+}
+
+// checkGolden compares got with testdata/name.golden, or rewrites the file
+// when the tests are run with -update.
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".golden")
+
+	if *update {
+		err := os.WriteFile(path, []byte(got), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run go test -update to create it", err)
+	}
+
+	if got != string(want) {
+		t.Errorf("%s output changed, run go test -update if intended\n--- got\n%s--- want\n%s", name, got, want)
+	}
+}
+
+func TestOutputGolden(t *testing.T) {
+	summary := summarizeTrades(fixtureTrades)
+
+	tests := []struct {
+		name  string
+		print func() error
+	}{
+		{"order", func() error {
+			for _, order := range fixtureOrders {
+				printOrder(order)
+				printSeparator()
+			}
+			return nil
+		}},
+		{"trade", func() error {
+			for _, trade := range fixtureTrades {
+				printTrade(trade)
+				printSeparator()
+			}
+			return nil
+		}},
+		{"book", func() error {
+			printBook(fixtureBook, false)
+			return nil
+		}},
+		{"book_cumulative", func() error {
+			printBook(fixtureBook, true)
+			return nil
+		}},
+		{"balances", func() error {
+			printBalances(fixtureBalances, fixturePortfolio)
+			return nil
+		}},
+		{"orders_table", func() error { return printOrdersTable(fixtureOrders, "") }},
+		{"orders_table_fields", func() error { return printOrdersTable(fixtureOrders, "Symbol,Price,Age") }},
+		{"orders_csv", func() error { return printOrdersCSV(fixtureOrders, "") }},
+		{"trades_table", func() error { return printTradesTable(fixtureTrades, "") }},
+		{"trades_csv", func() error { return printTradesCSV(fixtureTrades, "") }},
+		{"trade_summary_table", func() error { return printTradeSummaryTable(summary, "") }},
+		{"trade_summary_csv", func() error { return printTradeSummaryCSV(summary, "") }},
+		{"balances_csv", func() error { return printBalancesCSV(fixtureBalances, "") }},
+		{"portfolio_json", func() error {
+			printJSON(fixturePortfolio)
+			return nil
+		}},
+		{"portfolio_pretty_json", func() error {
+			prettyJSON = true
+			printJSON(fixturePortfolio)
+			return nil
+		}},
+		{"trade_summary_json", func() error {
+			printJSON(summary)
+			return nil
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkGolden(t, tt.name, captureOutput(t, tt.print))
+		})
+	}
+}
+
+// labelValues maps each "Label: value" line of out to its value.
+func labelValues(out string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		label, value, ok := strings.Cut(line, ":")
+		if ok {
+			values[label] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
+
+func TestPrecision(t *testing.T) {
+	trade := gemini.Trade{
+		OrderId:     "1004",
+		Timestamp:   fixtureTime.Unix(),
+		Type:        "Sell",
+		Price:       3119.257,
+		Amount:      1.5,
+		FeeCurrency: "USD",
+		FeeAmount:   4.6788,
+	}
+	book := gemini.Book{
+		Bids: []gemini.BookEntry{{Price: 3119.257, Amount: 1.5}},
+		Asks: []gemini.BookEntry{{Price: 3120.5, Amount: 0.125}},
+	}
+
+	tests := []struct {
+		precision int
+		price     string
+		amount    string
+		fee       string
+		bid       string
+		ask       string
+	}{
+		{0, "3119", "2", "5", "3119  2", "3120  0"},
+		{2, "3119.26", "1.50", "4.68", "3119.26  1.50", "3120.50  0.12"},
+		{8, "3119.25700000", "1.50000000", "4.67880000", "3119.25700000  1.50000000", "3120.50000000  0.12500000"},
+	}
+
+	for _, tt := range tests {
+		got := labelValues(captureOutput(t, func() error {
+			precision = tt.precision
+			printTrade(trade)
+			return nil
+		}))
+		if got["Price"] != tt.price || got["Amount"] != tt.amount || got["FeeAmount"] != tt.fee {
+			t.Errorf("printTrade at precision %d: Price %q, Amount %q, FeeAmount %q, want %q, %q, %q",
+				tt.precision, got["Price"], got["Amount"], got["FeeAmount"], tt.price, tt.amount, tt.fee)
+		}
+
+		lines := strings.Split(captureOutput(t, func() error {
+			precision = tt.precision
+			printBook(book, false)
+			return nil
+		}), "\n")
+		if strings.TrimSpace(lines[0]) != tt.ask || strings.TrimSpace(lines[2]) != tt.bid {
+			t.Errorf("printBook at precision %d: ask %q, bid %q, want %q, %q", tt.precision, lines[0], lines[2], tt.ask, tt.bid)
+		}
+	}
+
+	// JSON keeps full precision whatever the flag says
+	full := captureOutput(t, func() error {
+		printJSON(trade)
+		return nil
+	})
+	for _, p := range []int{0, 2} {
+		got := captureOutput(t, func() error {
+			precision = p
+			printJSON(trade)
+			return nil
+		})
+		if got != full {
+			t.Errorf("printJSON at precision %d = %s, want %s", p, got, full)
+		}
+	}
+}
+
+func TestConversionPrecision(t *testing.T) {
+	details := &symbolDetails{
+		Symbol:         "btcusd",
+		BaseCurrency:   "BTC",
+		QuoteCurrency:  "USD",
+		TickSize:       1e-8,
+		QuoteIncrement: 0.01,
+	}
+	res := conversion{
+		Market:      "btcusd",
+		Price:       64250.125,
+		BaseAmount:  0.00155642,
+		QuoteAmount: 100,
+		FeeBps:      100,
+		Fee:         1,
+	}
+
+	// amounts follow the market's tick size and quote increment, and only
+	// the price follows --precision
+	for _, tt := range []struct {
+		precision int
+		price     string
+	}{
+		{0, "64250"},
+		{2, "64250.12"},
+		{8, "64250.12500000"},
+	} {
+		got := labelValues(captureOutput(t, func() error {
+			precision = tt.precision
+			printConversion(res, details)
+			return nil
+		}))
+
+		want := map[string]string{
+			"Price":       tt.price,
+			"BaseAmount":  "0.00155642 BTC",
+			"QuoteAmount": "100.00 USD",
+			"Fee":         "1.00 USD (100 bps)",
+		}
+		for label, value := range want {
+			if got[label] != value {
+				t.Errorf("printConversion at precision %d: %s %q, want %q", tt.precision, label, got[label], value)
+			}
+		}
+	}
+}
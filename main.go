@@ -1,89 +1,981 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/debug"
 	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/fatih/color"
-	"github.com/jsgoyette/gemini"
 	"github.com/urfave/cli"
 )
 
 const (
 	ERROR_API_KEY_MISSING = "Missing API keys. Set GEMINI_API_SANDBOX_KEY " +
 		"and GEMINI_API_SANDBOX_SECRET in the environment, or " +
-		"GEMINI_API_KEY and GEMINI_API_SECRET for live mode"
+		"GEMINI_API_KEY and GEMINI_API_SECRET for live mode, " +
+		"or pass --key-file and --secret-file"
 
+	ERROR_ALERT_TIMEOUT    = "Timed out before the alert triggered"
 	ERROR_AMBIGUOUS_AMOUNT = "Ambiguous use of both amt and base-amt flags"
+	ERROR_AMBIGUOUS_ARG    = "Ambiguous use of both an argument and the flag"
+	ERROR_AMBIGUOUS_PCT    = "Ambiguous use of pct with amt or base-amt flags"
+	ERROR_AMBIGUOUS_SECRET = "Ambiguous use of both secret-file and secret-stdin"
+	ERROR_APPEND_OUT       = "The append flag requires out"
+	ERROR_AUDIT_LOG        = "Failed to write audit log"
+	ERROR_BELOW_MIN_ORDER  = "Amount is below the minimum order size"
+	ERROR_CANDLE_INTERVAL  = "Interval must be one of"
+	ERROR_HISTORY_EVENT    = "No such history event"
+	ERROR_INVALID_ADDRESS  = "Address must not be empty"
+	ERROR_INTERRUPTED      = "Interrupted"
 	ERROR_INVALID_AMOUNT   = "Amount or Base Amount must be above 0"
+	ERROR_INVALID_BRACKET  = "Market must be between the stop and take-profit"
+	ERROR_INVALID_CAPITAL  = "Capital must be above 0"
+	ERROR_INVALID_COLUMN   = "Fields must be any of"
+	ERROR_INVALID_API_URL  = "API URL must be an absolute http or https URL"
+	ERROR_INVALID_COUNT    = "Count must not be negative"
+	ERROR_INVALID_CURRENCY = "Currency must not be empty"
+	ERROR_INVALID_DURATION = "Duration must be above 0"
+	ERROR_INVALID_FIELD    = "Field must be one of"
+	ERROR_INVALID_FORMAT   = "Invalid format template"
+	ERROR_INVALID_INTERVAL = "Interval must be above 0"
+	ERROR_INVALID_LEVEL    = "Log level must be one of"
+	ERROR_INVALID_MARKET   = "Unknown market"
+	ERROR_INVALID_ORDERS   = "Orders must be above 0"
+	ERROR_INVALID_PCT      = "Pct must be above 0 and at most 100"
+	ERROR_INVALID_POSITION = "Max position must be above 0"
 	ERROR_INVALID_PRICE    = "Price must be above 0"
-	ERROR_MAX_RETRIES      = "Max retries"
+	ERROR_INVALID_RANGE    = "To date is before from date"
+	ERROR_INVALID_REPRICE  = "Reprice-bps must be above 0"
+	ERROR_INVALID_REQUOTES = "Max requotes must be above 0"
+	ERROR_INVALID_SMA      = "Sma-cross must be fast,slow periods with fast below slow"
+	ERROR_INVALID_SHELL    = "Shell must be one of"
+	ERROR_INVALID_SIDE     = "Side must be buy or sell"
+	ERROR_INVALID_SLICES   = "Slices must be above 0"
+	ERROR_INVALID_SORT     = "Sort must be one of"
+	ERROR_INVALID_SPREAD   = "Spread-bps must be above 0"
+	ERROR_INVALID_TIF      = "Tif must be one of"
+	ERROR_INVALID_TRAIL    = "Trail must be a price distance or a percentage above 0, e.g. 50 or 2%"
+	ERROR_INVALID_TYPE     = "Order type must be limit or market"
+	ERROR_INVALID_WINDOW   = "Window must be above 0"
+	ERROR_LADDER_CROSSES   = "Ladder price would cross the book"
+	ERROR_MAX_DEVIATION    = "Price is beyond max-deviation"
+	ERROR_MAX_REQUOTES     = "Max requotes"
+	ERROR_MAX_SLIPPAGE     = "Price moved beyond max slippage"
+	ERROR_METRICS_ADDR     = "Unable to serve metrics"
+	ERROR_MISSING_CLIENT   = "Missing client order id"
+	ERROR_MISSING_FILE     = "Missing order file"
+	ERROR_MISSING_TXID     = "Missing order id"
+	ERROR_MM_CANCEL        = "Failed to cancel a quote, check active orders"
+	ERROR_NESTED_REPL      = "Already in the repl"
 	ERROR_NO_ASKS          = "No asks in book"
 	ERROR_NO_BIDS          = "No bids in book"
+	ERROR_NO_REPLACEMENT   = "Pass a new price, amt or base-amt"
+	ERROR_NO_STRATEGY      = "Pass a strategy such as --sma-cross"
+	ERROR_NO_THRESHOLD     = "Pass --above or --below"
+	ERROR_NOT_CONFIRMED    = "Aborted"
+	ERROR_NOT_TTY          = "Not a terminal, pass --yes to confirm"
+	ERROR_OCO_CANCEL       = "Failed to cancel the other order of the bracket"
+	ERROR_OPEN_QUOTE       = "Unterminated quote"
+	ERROR_ORDER_NOT_FOUND  = "No orders with client order id"
+	ERROR_ORDER_NOT_LIVE   = "Order is no longer live"
+	ERROR_PAPER_FILE       = "Unable to use the paper trading file"
+	ERROR_PAPER_MODE       = "Not available in paper trading mode"
+	ERROR_PRICE_INCREMENT  = "Price must be a multiple of"
+	ERROR_PROFILE_MISSING  = "Profile not found in config file"
+	ERROR_REPLACE_FAILED   = "Cancelled the order but couldn't place its replacement"
+	ERROR_SECRET_TTY       = "Pipe the secret into secret-stdin rather than typing it"
+	ERROR_STALE_BOOK       = "Order book is stale"
+	ERROR_STREAM_AUTH      = "Websocket authentication failed, check API keys"
+	ERROR_TIMEOUT          = "Request timed out"
+	ERROR_UNKNOWN_CURRENCY = "Unknown currency"
+	ERROR_WAIT_TIMEOUT     = "Timed out waiting for order"
+	ERROR_WATCH_MARKETS    = "Watch takes a single market"
 
-	RETRIES_MAX = 50
+	REQUOTES_MAX = 50
+
+	TRADES_PAGE_SIZE    = 500
+	TRANSFERS_PAGE_SIZE = 50
+
+	RETRY_BASE_DELAY = 500 * time.Millisecond
+	STREAM_MAX_DELAY = 30 * time.Second
+
+	COMPLETION_TIMEOUT = 2 * time.Second
+
+	SYMBOL_CACHE_TTL = 24 * time.Hour
+
+	// --metrics-addr gives scrapes in progress this long to finish on exit
+	METRICS_SHUTDOWN_TIMEOUT = 5 * time.Second
+
+	// sessions that require heartbeats are cancelled after 30s without one
+	HEARTBEAT_INTERVAL = 15 * time.Second
+
+	// Exit codes by class of error:
+	//   1 anything not covered below
+	//   2 bad flags or input, rejected before reaching the exchange
+	//   3 the exchange returned an error, or failed with a server error
+	//   4 insufficient funds for the order or withdrawal
+	//   5 the exchange couldn't be reached
+	//   6 missing or rejected API credentials
+	//   7 the exchange rejected the order parameters
+	//   8 the order wasn't found
+	//   9 rate limited, after exhausting retries
+	//   130 interrupted with Ctrl-C
+	EXIT_ERROR              = 1
+	EXIT_USAGE              = 2
+	EXIT_API_ERROR          = 3
+	EXIT_INSUFFICIENT_FUNDS = 4
+	EXIT_NETWORK            = 5
+	EXIT_AUTH_ERROR         = 6
+	EXIT_INVALID_ORDER      = 7
+	EXIT_NOT_FOUND          = 8
+	EXIT_RATE_LIMITED       = 9
+	EXIT_INTERRUPTED        = 130
+
+	CURSOR_HIDE  = "\033[?25l"
+	CURSOR_SHOW  = "\033[?25h"
+	TICKER_LINES = 4
+
+	// TICKER_WORKERS bounds the tickers fetched at once for several markets
+	TICKER_WORKERS = 4
+
+	HISTORY_FILE_NAME = ".gemini-cli_history"
+	HISTORY_SIZE      = 1000
+
+	CONFIG_FILE_NAME = ".gemini-cli.toml"
+	DEFAULT_PROFILE  = "default"
+
+	// fees are assumed when none are configured and the account's can't
+	// be fetched
+	DEFAULT_FEE_BPS = 100
+
+	// paper portfolios start with this much USD and pay these fees
+	PAPER_FILE_NAME     = ".gemini-cli_paper.json"
+	PAPER_STARTING_USD  = 10000
+	PAPER_MAKER_FEE_BPS = 10
+	PAPER_TAKER_FEE_BPS = 35
 )
 
+// API_ERROR_REASONS maps the reason field of a Gemini error response to a
+// readable description and the exit code scripts can branch on.
+var API_ERROR_REASONS = map[string]apiReason{
+	"AuctionNotOpen":       {"Auction not open", EXIT_INVALID_ORDER},
+	"ClientOrderIdTooLong": {"Client order id too long", EXIT_INVALID_ORDER},
+	"InsufficientFunds":    {"Insufficient funds", EXIT_INSUFFICIENT_FUNDS},
+	"InvalidApiKey":        {"Invalid API key", EXIT_AUTH_ERROR},
+	"InvalidNonce":         {"Invalid nonce", EXIT_AUTH_ERROR},
+	"InvalidPrice":         {"Invalid price", EXIT_INVALID_ORDER},
+	"InvalidQuantity":      {"Invalid quantity", EXIT_INVALID_ORDER},
+	"InvalidSide":          {"Invalid side", EXIT_INVALID_ORDER},
+	"InvalidSignature":     {"Invalid signature", EXIT_AUTH_ERROR},
+	"InvalidSymbol":        {"Invalid symbol", EXIT_INVALID_ORDER},
+	"Maintenance":          {"Exchange under maintenance", EXIT_API_ERROR},
+	"MissingApikeyHeader":  {"Missing API key", EXIT_AUTH_ERROR},
+	"MissingRole":          {"API key is missing the required role", EXIT_AUTH_ERROR},
+	"OrderNotFound":        {"Order not found", EXIT_NOT_FOUND},
+	"RateLimit":            {"Rate limited", EXIT_RATE_LIMITED},
+	"System":               {"Exchange system error", EXIT_API_ERROR},
+}
+
+// USAGE_ERRORS are the prefixes of errors caused by bad input, which exit
+// with EXIT_USAGE. The flag package's own parse errors are included.
+var USAGE_ERRORS = []string{
+	ERROR_AMBIGUOUS_AMOUNT,
+	ERROR_AMBIGUOUS_ARG,
+	ERROR_AMBIGUOUS_PCT,
+	ERROR_AMBIGUOUS_SECRET,
+	ERROR_APPEND_OUT,
+	ERROR_BELOW_MIN_ORDER,
+	ERROR_CANDLE_INTERVAL,
+	ERROR_INVALID_ADDRESS,
+	ERROR_INVALID_AMOUNT,
+	ERROR_INVALID_BRACKET,
+	ERROR_INVALID_CAPITAL,
+	ERROR_INVALID_COLUMN,
+	ERROR_INVALID_API_URL,
+	ERROR_INVALID_COUNT,
+	ERROR_INVALID_CURRENCY,
+	ERROR_INVALID_DURATION,
+	ERROR_INVALID_FIELD,
+	ERROR_INVALID_FORMAT,
+	ERROR_INVALID_INTERVAL,
+	ERROR_INVALID_LEVEL,
+	ERROR_INVALID_MARKET,
+	ERROR_INVALID_ORDERS,
+	ERROR_INVALID_PCT,
+	ERROR_INVALID_POSITION,
+	ERROR_INVALID_PRICE,
+	ERROR_INVALID_RANGE,
+	ERROR_INVALID_REPRICE,
+	ERROR_INVALID_REQUOTES,
+	ERROR_INVALID_SMA,
+	ERROR_INVALID_SHELL,
+	ERROR_INVALID_SIDE,
+	ERROR_INVALID_SLICES,
+	ERROR_INVALID_SORT,
+	ERROR_INVALID_SPREAD,
+	ERROR_INVALID_TIF,
+	ERROR_INVALID_TRAIL,
+	ERROR_INVALID_TYPE,
+	ERROR_INVALID_WINDOW,
+	ERROR_LADDER_CROSSES,
+	ERROR_MAX_DEVIATION,
+	ERROR_MISSING_CLIENT,
+	ERROR_MISSING_FILE,
+	ERROR_MISSING_TXID,
+	ERROR_NO_REPLACEMENT,
+	ERROR_NO_STRATEGY,
+	ERROR_NO_THRESHOLD,
+	ERROR_NOT_TTY,
+	ERROR_PRICE_INCREMENT,
+	ERROR_PROFILE_MISSING,
+	ERROR_SECRET_TTY,
+	ERROR_UNKNOWN_CURRENCY,
+	ERROR_WATCH_MARKETS,
+	"flag provided but not defined",
+	"invalid value",
+}
+
+// ORDER_OPTIONS are the execution options accepted by --tif.
+var ORDER_OPTIONS = []string{
+	"maker-or-cancel",
+	"immediate-or-cancel",
+	"fill-or-kill",
+	"auction-only",
+}
+
+// ORDER_SORT_FIELDS are the fields active orders can be sorted by.
+var ORDER_SORT_FIELDS = []string{"price", "amount", "timestamp"}
+
+// ORDER_EVENT_TYPES are the order events printed by stream-orders.
+var ORDER_EVENT_TYPES = []string{
+	"accepted",
+	"fill",
+	"cancelled",
+	"rejected",
+}
+
+// RETRYABLE_ERRORS are substrings of error messages from the gemini
+// package that indicate a rate limit or transient server error.
+var RETRYABLE_ERRORS = []string{
+	"429",
+	"500",
+	"502",
+	"503",
+	"504",
+	"RateLimit",
+	"Too Many Requests",
+}
+
+// CANDLE_INTERVALS are the time frames accepted by the candles endpoint.
+var CANDLE_INTERVALS = []string{"1m", "5m", "15m", "30m", "1hr", "6hr", "1day"}
+
+// LOG_LEVELS are the values accepted by --log-level, from most to least
+// verbose.
+var LOG_LEVELS = []string{"debug", "info", "warn", "error"}
+
+// PRICE_FIELDS are the values the mid command can print.
+var PRICE_FIELDS = []string{"mid", "bid", "ask", "last"}
+
+// DEPOSIT_NETWORKS maps a currency to the network name used by the
+// deposit address endpoints.
+var DEPOSIT_NETWORKS = map[string]string{
+	"bch": "bitcoincash",
+	"btc": "bitcoin",
+	"eth": "ethereum",
+	"ltc": "litecoin",
+	"zec": "zcash",
+}
+
+type apiReason struct {
+	Description string
+	ExitCode    int
+}
+
+// profile is a named set of credentials from the config file, selected
+// with --profile.
+type profile struct {
+	Key    string `toml:"key"`
+	Secret string `toml:"secret"`
+	Live   bool   `toml:"live"`
+}
+
+type config struct {
+	LiveKey       string `toml:"live_key"`
+	LiveSecret    string `toml:"live_secret"`
+	SandboxKey    string `toml:"sandbox_key"`
+	SandboxSecret string `toml:"sandbox_secret"`
+	Market        string `toml:"market"`
+	Bps           int    `toml:"bps"`
+
+	Profiles map[string]profile `toml:"profiles"`
+}
+
 var (
 	gemini_api_key    string
 	gemini_api_secret string
+	gemini_api_url    string
+	gemini_api_live   bool
+
+	// paperTrading is set by --paper, see paperExchange
+	paperTrading bool
+
+	cfg config
+
+	// stdout is where the print helpers write, so their output can be
+	// captured and compared against fixtures
+	stdout io.Writer = os.Stdout
+
+	// now is the clock order ages are measured on, fixed alongside stdout
+	// when output is compared against fixtures
+	now = time.Now
+
+	maxBookAge time.Duration
+	maxRetries int
+	precision  int
+
+	// requestCtx is cancelled on the first interrupt, aborting any request
+	// in flight
+	requestCtx     context.Context
+	cancelRequests context.CancelFunc
+	requestTimeout time.Duration
+
+	interruptHeld  chan struct{}
+	interrupted    bool
+	interruptMutex sync.Mutex
+
+	// stdinLines is fed by a single reader shared by everything that
+	// prompts, see readLine
+	stdinLines chan stdinLine
+	stdinOnce  sync.Once
 
-	g *gemini.Api
+	prettyJSON   bool
+	quiet        bool
+	outputFormat *template.Template
+	timeEpoch    bool
+	timeUTC      bool
+
+	symbols            []string
+	symbolDetailsCache = map[string]*symbolDetails{}
 
 	red       = color.New(color.FgRed).SprintFunc()
+	green     = color.New(color.FgGreen).SprintFunc()
 	blue      = color.New(color.FgHiBlue).SprintFunc()
 	boldWhite = color.New(color.FgWhite).Add(color.Bold).SprintFunc()
 )
 
 func main() {
+	defer recoverPanic()
+
 	app := cli.NewApp()
 
 	app.Usage = "CLI for the Gemini Bitcoin exchange API"
 	app.UsageText = "gemini-cli [global options] command [command options]"
-	app.Version = "0.0.1"
+	app.Version = buildVersion
+	cli.VersionPrinter = printVersion
 
-	app.Flags = []cli.Flag{liveFlag}
+	app.Flags = []cli.Flag{
+		apiUrlFlag,
+		appendFlag,
+		auditLogFlag,
+		configFlag,
+		debugFlag,
+		epochFlag,
+		formatFlag,
+		keyFileFlag,
+		liveFlag,
+		logLevelFlag,
+		maxBookAgeFlag,
+		maxRetriesFlag,
+		noColorFlag,
+		outFlag,
+		paperFlag,
+		paperFileFlag,
+		precisionFlag,
+		prettyFlag,
+		profileFlag,
+		quietFlag,
+		refreshSymbolsFlag,
+		requestTimeoutFlag,
+		secretFileFlag,
+		secretStdinFlag,
+		utcFlag,
+	}
 	app.Before = beforeApp
 	app.Commands = commands
+	app.EnableBashCompletion = true
+
+	for i := range app.Commands {
+		app.Commands[i].BashComplete = completeCommand
+
+		if v, ok := FORMAT_TYPES[app.Commands[i].Name]; ok {
+			fields := "Fields for --format: " + strings.Join(formatFields(v), ", ")
+			if app.Commands[i].Description != "" {
+				fields = app.Commands[i].Description + "\n\n   " + fields
+			}
+			app.Commands[i].Description = fields
+		}
+	}
+
+	requestCtx, cancelRequests = context.WithCancel(context.Background())
+	go handleInterrupt()
 
 	sort.Sort(cli.FlagsByName(app.Flags))
 	sort.Sort(cli.CommandsByName(app.Commands))
 
-	app.Run(os.Args)
+	err := app.Run(os.Args)
+	if err != nil {
+		os.Exit(getExitCode(err))
+	}
+}
+
+// recoverPanic prints a panic from the main goroutine with its stack the
+// way the runtime would, but through redact, and exits with the runtime's
+// status of 2.
+func recoverPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "panic: %s\n\n%s", redact(fmt.Sprint(r)), redact(string(debug.Stack())))
+	os.Exit(2)
 }
 
 func beforeApp(c *cli.Context) error {
+	err := setLogLevel(c.String("log-level"))
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	err = openOut(c.String("out"), c.Bool("append"))
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	if format := c.String("format"); format != "" {
+		outputFormat, err = parseFormat(format)
+		if err != nil {
+			printError(err)
+			return err
+		}
+	}
+
+	// completion scripts and build info are offline and need no keys
+	if cmd := c.Args().First(); cmd == "completion" || cmd == "version" {
+		return nil
+	}
+
 	live := c.Bool("live")
+	maxBookAge = c.Duration("max-book-age")
+	maxRetries = c.Int("max-retries")
+	precision = c.Int("precision")
+	prettyJSON = c.Bool("pretty")
+	quiet = c.Bool("quiet")
+	refreshSymbols = c.Bool("refresh-symbols")
+	timeEpoch = c.Bool("epoch")
+	timeUTC = c.Bool("utc")
+
+	requestTimeout = c.Duration("request-timeout")
 
-	err := verifyApiKeys(live)
+	// the gemini package and the direct requests both go through the
+	// default transport
+	if c.Bool("debug") {
+		http.DefaultTransport = &debugTransport{http.DefaultTransport}
+	}
+	http.DefaultTransport = &contextTransport{http.DefaultTransport}
+
+	if c.Bool("no-color") || os.Getenv("NO_COLOR") != "" || !isTerminalOutput() {
+		color.NoColor = true
+	}
+
+	err = loadConfig(c.String("config"), c.IsSet("config"))
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	p, err := getProfile(c.String("profile"), c.IsSet("profile"))
 	if err != nil {
 		printError(err)
 		return err
 	}
 
-	g = gemini.New(live, gemini_api_key, gemini_api_secret)
+	if p != nil && p.Live {
+		live = true
+	}
+
+	// paper trading prices off the live market, and only needs keys for
+	// the private endpoints it doesn't simulate
+	paper := c.Bool("paper")
+	if paper {
+		live = true
+	} else {
+		key, secret, err := readCredentials(c.String("key-file"), c.String("secret-file"), c.Bool("secret-stdin"))
+		if err != nil {
+			printError(err)
+			return err
+		}
+
+		err = verifyApiKeys(live, p, key, secret)
+		if err != nil {
+			printError(err)
+			return err
+		}
+	}
+
+	var ex exchange = newApiExchange(live, gemini_api_key, gemini_api_secret)
+	gemini_api_url = getApiUrl(live)
+	gemini_api_live = live && !paper
+	paperTrading = paper
+
+	if paper {
+		path, err := paperPath(c.String("paper-file"))
+		if err == nil {
+			ex, err = openPaper(path, ex)
+		}
+		if err != nil {
+			printError(err)
+			return err
+		}
+	}
+
+	if path := c.String("audit-log"); path != "" {
+		ex, err = openAuditLog(path, ex)
+		if err != nil {
+			printError(err)
+			return err
+		}
+	}
+
+	if apiUrl := c.String("api-url"); apiUrl != "" {
+		base, err := url.Parse(apiUrl)
+		if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+			err := fmt.Errorf("%s: %s", ERROR_INVALID_API_URL, apiUrl)
+			printError(err)
+			return err
+		}
+
+		gemini_api_url = strings.TrimRight(apiUrl, "/")
+		http.DefaultTransport = &baseUrlTransport{base, http.DefaultTransport}
+	}
+
+	c.App.Metadata["exchange"] = ex
 
 	return nil
 }
 
+// appExchange returns the client beforeApp set up for the app.
+func appExchange(c *cli.Context) exchange {
+	return c.App.Metadata["exchange"].(exchange)
+}
+
+// withExchange adapts a command that talks to the exchange into an
+// action, passing it the client from appExchange.
+func withExchange(action func(c *cli.Context, ex exchange) error) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		return action(c, appExchange(c))
+	}
+}
+
+// beforeArgs lets the first positional argument stand in for the named
+// flag, e.g. `ticker ethusd` for `ticker --mkt ethusd`. Passing both is
+// ambiguous. Note that flags have to come before the argument.
+func beforeArgs(name string) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		if c.NArg() == 0 {
+			return nil
+		}
+
+		if c.IsSet(name) {
+			err := fmt.Errorf("%s: %s", ERROR_AMBIGUOUS_ARG, name)
+			printError(err)
+			return err
+		}
+
+		return c.Set(name, c.Args().First())
+	}
+}
+
+// chainBefore runs each of fns in turn, stopping at the first error.
+func chainBefore(fns ...cli.BeforeFunc) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		for _, fn := range fns {
+			err := fn(c)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// beforeMarket rejects a mkt flag that isn't one of the exchange's
+// symbols before any order is attempted.
+func beforeMarket(c *cli.Context) error {
+	err := validateMarket(appExchange(c), getMarket(c))
+	if err != nil {
+		printError(err)
+	}
+	return err
+}
+
 func beforeTransaction(c *cli.Context) error {
 	if c.Float64("base-amt") > 0 && c.Float64("amt") > 0 {
 		err := errors.New(ERROR_AMBIGUOUS_AMOUNT)
 		printError(err)
 		return err
 	}
+
+	if c.IsSet("pct") && (c.Float64("base-amt") > 0 || c.Float64("amt") > 0) {
+		err := errors.New(ERROR_AMBIGUOUS_PCT)
+		printError(err)
+		return err
+	}
+
+	if c.IsSet("pct") && (c.Float64("pct") <= 0 || c.Float64("pct") > 100) {
+		err := errors.New(ERROR_INVALID_PCT)
+		printError(err)
+		return err
+	}
+
+	err := validateSide(c.String("side"))
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	err = validateTif(c.String("tif"))
+	if err != nil {
+		printError(err)
+		return err
+	}
+
+	return beforeMarket(c)
+}
+
+// handleInterrupt cancels requestCtx on the first interrupt, so that the
+// running command fails cleanly at its next request or wait, unless the
+// interrupt is being held. A second interrupt exits straight away.
+func handleInterrupt() {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	for range interrupt {
+		interruptMutex.Lock()
+		if interrupted {
+			fmt.Fprintln(os.Stderr, "")
+			os.Exit(EXIT_INTERRUPTED)
+		}
+		interrupted = true
+
+		if interruptHeld != nil {
+			close(interruptHeld)
+			interruptHeld = nil
+		} else {
+			cancelRequests()
+		}
+		interruptMutex.Unlock()
+	}
+}
+
+// resetInterrupt returns to the state before any interrupt, with a fresh
+// requestCtx if the old one was cancelled, so that the repl can carry on
+// after a command is interrupted.
+func resetInterrupt() {
+	interruptMutex.Lock()
+	defer interruptMutex.Unlock()
+
+	interrupted = false
+	if requestCtx.Err() != nil {
+		requestCtx, cancelRequests = context.WithCancel(context.Background())
+	}
+}
+
+// holdInterrupt makes the first interrupt close the returned channel
+// instead of cancelling requests, for work that should only stop at a safe
+// point. release restores the default.
+func holdInterrupt() (<-chan struct{}, func()) {
+	held := make(chan struct{})
+
+	interruptMutex.Lock()
+	interruptHeld = held
+	interruptMutex.Unlock()
+
+	release := func() {
+		interruptMutex.Lock()
+		if interruptHeld == held {
+			interruptHeld = nil
+		}
+		interruptMutex.Unlock()
+	}
+
+	return held, release
+}
+
+// setLogLevel sends diagnostic messages at level and above to stderr,
+// keeping them apart from command output on stdout.
+func setLogLevel(level string) error {
+	var valid bool
+	for _, l := range LOG_LEVELS {
+		if level == l {
+			valid = true
+			break
+		}
+	}
+
+	if !valid {
+		return fmt.Errorf("%s: %s", ERROR_INVALID_LEVEL, strings.Join(LOG_LEVELS, ", "))
+	}
+
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return err
+	}
+
+	slog.SetDefault(slog.New(newLogHandler(os.Stderr, l)))
+
 	return nil
 }
 
-func verifyApiKeys(live bool) error {
+// newLogHandler writes records at level and above to w as text, with
+// every attribute passed through redactAttr.
+func newLogHandler(w io.Writer, level slog.Leveler) slog.Handler {
+	return slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	})
+}
 
-	if live {
-		gemini_api_key = os.Getenv("GEMINI_API_KEY")
-		gemini_api_secret = os.Getenv("GEMINI_API_SECRET")
-	} else {
-		gemini_api_key = os.Getenv("GEMINI_API_SANDBOX_KEY")
-		gemini_api_secret = os.Getenv("GEMINI_API_SANDBOX_SECRET")
+// redactAttr runs redact over log messages, string attributes and errors.
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	switch v := a.Value.Any().(type) {
+	case string:
+		a.Value = slog.StringValue(redact(v))
+	case error:
+		a.Value = slog.StringValue(redact(v.Error()))
+	}
+	return a
+}
+
+// openOut points stdout at path when one is given, truncating the file
+// unless appending.
+func openOut(path string, appending bool) error {
+	if path == "" {
+		if appending {
+			return errors.New(ERROR_APPEND_OUT)
+		}
+		return nil
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appending {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return err
+	}
+
+	stdout = f
+	return nil
+}
+
+// readCredentials returns the key and secret passed as files or, for the
+// secret, piped in on stdin. Either is empty when not given.
+func readCredentials(keyFile, secretFile string, secretStdin bool) (string, string, error) {
+	if secretFile != "" && secretStdin {
+		return "", "", errors.New(ERROR_AMBIGUOUS_SECRET)
+	}
+
+	var key, secret string
+	var err error
+
+	if keyFile != "" {
+		key, err = readCredentialFile(keyFile)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	if secretFile != "" {
+		secret, err = readCredentialFile(secretFile)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	if secretStdin {
+		if isTerminal(os.Stdin) {
+			return "", "", errors.New(ERROR_SECRET_TTY)
+		}
+
+		secret, err = readStdinSecret()
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	return key, secret, nil
+}
+
+// readCredentialFile reads a key or secret with any trailing newline
+// trimmed, warning when the file can be read by other users.
+func readCredentialFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	if info.Mode().Perm()&0077 != 0 {
+		slog.Warn("Credential file is accessible to other users", "path", path, "mode", info.Mode().Perm())
+	}
+
+	chars, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(chars), "\r\n"), nil
+}
+
+// readStdinSecret reads the first line of stdin a byte at a time, so that
+// nothing after it is consumed and the rest of stdin is left for --stdin
+// or the repl.
+func readStdinSecret() (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+
+	for {
+		n, err := os.Stdin.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return strings.TrimRight(string(line), "\r"), nil
+}
+
+// getProfile looks up the named profile in cfg. A missing profile is only
+// an error when it was asked for explicitly; otherwise nil is returned and
+// credentials come from the environment or the top level of the config.
+func getProfile(name string, explicit bool) (*profile, error) {
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		if explicit {
+			return nil, fmt.Errorf("%s: %s", ERROR_PROFILE_MISSING, name)
+		}
+		return nil, nil
+	}
+
+	return &p, nil
+}
+
+// loadConfig reads the config file into cfg. When no path is given the
+// file is looked up in the home directory, and a missing file is only an
+// error if the path was passed explicitly.
+func loadConfig(path string, explicit bool) error {
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		path = filepath.Join(home, CONFIG_FILE_NAME)
+	}
+
+	_, err := toml.DecodeFile(path, &cfg)
+	if os.IsNotExist(err) && !explicit {
+		return nil
+	}
+
+	return err
+}
+
+func validateMarket(ex exchange, mkt string) error {
+	symbols, err := getSymbols(ex)
+	if err != nil {
+		return err
+	}
+
+	for _, symbol := range symbols {
+		if symbol == mkt {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s: %s", ERROR_INVALID_MARKET, mkt)
+}
+
+func validateSide(side string) error {
+	if side != "buy" && side != "sell" {
+		return fmt.Errorf("%s: %s", ERROR_INVALID_SIDE, side)
+	}
+	return nil
+}
+
+// validateTif checks an execution option against ORDER_OPTIONS. Commands
+// without a tif flag pass an empty string, which is allowed.
+func validateTif(tif string) error {
+	if tif == "" {
+		return nil
+	}
+
+	for _, option := range ORDER_OPTIONS {
+		if option == tif {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s: %s", ERROR_INVALID_TIF, strings.Join(ORDER_OPTIONS, ", "))
+}
+
+func verifyApiKeys(live bool, p *profile, key, secret string) error {
+
+	// env vars take precedence, the config file fills in what's missing.
+	// A profile's credentials are used as-is. A key or secret read from a
+	// file or stdin overrides all of them.
+	switch {
+	case p != nil:
+		gemini_api_key = p.Key
+		gemini_api_secret = p.Secret
+	case live:
+		gemini_api_key = getEnv("GEMINI_API_KEY", cfg.LiveKey)
+		gemini_api_secret = getEnv("GEMINI_API_SECRET", cfg.LiveSecret)
+	default:
+		gemini_api_key = getEnv("GEMINI_API_SANDBOX_KEY", cfg.SandboxKey)
+		gemini_api_secret = getEnv("GEMINI_API_SANDBOX_SECRET", cfg.SandboxSecret)
+	}
+
+	if key != "" {
+		gemini_api_key = key
+	}
+	if secret != "" {
+		gemini_api_secret = secret
 	}
 
 	if gemini_api_key == "" || gemini_api_secret == "" {
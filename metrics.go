@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/jsgoyette/gemini"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// The metrics are recorded whether or not --metrics-addr serves them. They
+// live on their own registry, registered once, so that commands run one
+// after another in the repl can each serve them.
+var (
+	metricsRegistry = prometheus.NewRegistry()
+	metricsOnce     sync.Once
+
+	ordersPlacedMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gemini_cli_orders_placed_total",
+		Help: "Orders placed.",
+	}, []string{"market", "side"})
+
+	fillsMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gemini_cli_fills_total",
+		Help: "Fills, counted each time an order executes more of its amount.",
+	}, []string{"market", "side"})
+
+	filledAmountMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gemini_cli_filled_amount_total",
+		Help: "Base amount filled.",
+	}, []string{"market", "side"})
+
+	errorsMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gemini_cli_errors_total",
+		Help: "Errors hit while running, including failed orders.",
+	}, []string{"command"})
+
+	positionMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gemini_cli_position",
+		Help: "Base amount bought less base amount sold since gemini-cli started.",
+	}, []string{"market"})
+
+	lastPriceMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gemini_cli_last_price",
+		Help: "Last price seen, of a fill or of the book.",
+	}, []string{"market"})
+)
+
+// startMetrics serves the metrics at /metrics on addr until the returned
+// func is called, which shuts the server down gracefully. An empty addr
+// serves nothing.
+func startMetrics(addr string) (func(), error) {
+	if addr == "" {
+		return func() {}, nil
+	}
+
+	metricsOnce.Do(func() {
+		metricsRegistry.MustRegister(
+			ordersPlacedMetric,
+			fillsMetric,
+			filledAmountMetric,
+			errorsMetric,
+			positionMetric,
+			lastPriceMetric,
+		)
+	})
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ERROR_METRICS_ADDR, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+
+	srv := &http.Server{Handler: mux}
+	go func() {
+		err := srv.Serve(ln)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn(ERROR_METRICS_ADDR, "error", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), METRICS_SHUTDOWN_TIMEOUT)
+		defer cancel()
+
+		srv.Shutdown(ctx)
+	}, nil
+}
+
+func recordPlaced(mkt, side string) {
+	ordersPlacedMetric.WithLabelValues(mkt, side).Inc()
+}
+
+// recordOrder counts an order placed, along with whatever it filled right
+// away.
+func recordOrder(mkt string, order gemini.Order) {
+	recordPlaced(mkt, order.Side)
+
+	if order.ExecutedAmount > 0 {
+		recordFill(mkt, order.Side, order.ExecutedAmount, order.AvgExecutionPrice)
+	}
+}
+
+// recordFill counts a fill of amount at price, moving the position and
+// the last price with it.
+func recordFill(mkt, side string, amount, price float64) {
+	fillsMetric.WithLabelValues(mkt, side).Inc()
+	filledAmountMetric.WithLabelValues(mkt, side).Add(amount)
+
+	if side == "sell" {
+		amount = -amount
+	}
+	positionMetric.WithLabelValues(mkt).Add(amount)
+
+	recordPrice(mkt, price)
+}
+
+func recordPrice(mkt string, price float64) {
+	if price > 0 {
+		lastPriceMetric.WithLabelValues(mkt).Set(price)
+	}
+}
+
+func recordError(command string) {
+	errorsMetric.WithLabelValues(command).Inc()
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/jsgoyette/gemini"
+)
+
+// mmReport totals what a market making session did. Position is the base
+// amount bought less the base amount sold.
+type mmReport struct {
+	Market        string  `json:"market"`
+	Placed        int     `json:"placed"`
+	Repriced      int     `json:"repriced"`
+	BaseBought    float64 `json:"base_bought"`
+	BaseSold      float64 `json:"base_sold"`
+	QuoteSpent    float64 `json:"quote_spent"`
+	QuoteReceived float64 `json:"quote_received"`
+	Position      float64 `json:"position"`
+}
+
+// mmQuote is one side of the market maker's quote: its live order, if
+// any, the mid it was priced off and how much of it has been counted.
+type mmQuote struct {
+	side    string
+	order   *gemini.Order
+	mid     float64
+	counted float64
+}
+
+// marketMaker keeps a bid and an ask around the mid of mkt.
+type marketMaker struct {
+	ex           exchange
+	mkt          string
+	amount       float64
+	spreadBps    float64
+	repriceBps   float64
+	maxPosition  float64
+	quotes       []*mmQuote
+	report       mmReport
+	printUpdates bool
+}
+
+func newMarketMaker(ex exchange, mkt string, amount, spreadBps, repriceBps, maxPosition float64) *marketMaker {
+	return &marketMaker{
+		ex:          ex,
+		mkt:         mkt,
+		amount:      amount,
+		spreadBps:   spreadBps,
+		repriceBps:  repriceBps,
+		maxPosition: maxPosition,
+		quotes:      []*mmQuote{{side: "buy"}, {side: "sell"}},
+		report:      mmReport{Market: mkt},
+	}
+}
+
+// update refreshes both quotes against the current book. Fills are counted
+// first, then a quote is cancelled when the position guard rules its side
+// out, replaced when the mid has moved more than repriceBps from the one
+// it was priced off, and placed when there is none.
+func (m *marketMaker) update() error {
+	top, err := getTopOfBook(m.ex, m.mkt)
+	if err != nil {
+		return err
+	}
+	recordPrice(m.mkt, top.Mid)
+
+	for _, q := range m.quotes {
+		if q.order != nil {
+			var order gemini.Order
+			err := withRetry(func() (err error) {
+				order, err = m.ex.OrderStatus(q.order.OrderId)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			m.count(q, order)
+		}
+
+		// buying at the limit would only grow a long position further, and
+		// selling a short one
+		guarded := (q.side == "buy" && m.report.Position >= m.maxPosition) ||
+			(q.side == "sell" && -m.report.Position >= m.maxPosition)
+
+		if guarded {
+			if err := m.cancel(q); err != nil {
+				return err
+			}
+			continue
+		}
+
+		price, err := m.quotePrice(q.side, top)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case q.order == nil:
+			amount, err := getLimitAmount(m.mkt, q.side, 0, m.amount, price, 0)
+			if err != nil {
+				return err
+			}
+
+			order, err := m.ex.NewOrder(m.mkt, newClientOrderId(), amount, price, q.side, []string{"maker-or-cancel"})
+			if err != nil {
+				return err
+			}
+
+			m.report.Placed++
+			recordPlaced(m.mkt, q.side)
+			m.printf("%s %v %s @ %v\n", blue("Placed"), amount, strings.ToUpper(q.side), price)
+			m.track(q, order, top.Mid)
+
+		case math.Abs(top.Mid-q.mid)/q.mid*10000 > m.repriceBps:
+			amount, err := getLimitAmount(m.mkt, q.side, 0, m.amount, price, 0)
+			if err != nil {
+				return err
+			}
+
+			order, cancelled, err := replaceOrder(m.ex, *q.order, newClientOrderId(), amount, price)
+			m.count(q, cancelled)
+			if err != nil {
+				return err
+			}
+
+			m.report.Repriced++
+			recordPlaced(m.mkt, q.side)
+			m.printf("%s %s to %v, mid %v\n", blue("Repriced"), strings.ToUpper(q.side), price, top.Mid)
+			m.track(q, order, top.Mid)
+		}
+	}
+
+	return nil
+}
+
+// quotePrice returns the price of the quote on side, half the spread away
+// from the mid and rounded to the market's price increment. A quote that
+// would cross the book is pulled back to the top of its own side, where
+// maker-or-cancel won't reject it.
+func (m *marketMaker) quotePrice(side string, top *topOfBook) (float64, error) {
+	offset := top.Mid * m.spreadBps / 2 / 10000
+
+	price := top.Mid - offset
+	if side == "buy" && price >= top.Ask {
+		price = top.Bid
+	}
+	if side == "sell" {
+		price = top.Mid + offset
+		if price <= top.Bid {
+			price = top.Ask
+		}
+	}
+
+	return getLimitPrice(m.mkt, price, false)
+}
+
+// track makes order the live order of q, unless it's already done.
+func (m *marketMaker) track(q *mmQuote, order gemini.Order, mid float64) {
+	q.order, q.mid, q.counted = &order, mid, 0
+	m.count(q, order)
+}
+
+// count adds to the report whatever order, the latest status of q's order,
+// has executed since it was last counted, and drops the order once it's
+// no longer live.
+func (m *marketMaker) count(q *mmQuote, order gemini.Order) {
+	if q.order == nil || order.OrderId != q.order.OrderId {
+		return
+	}
+
+	if filled := order.ExecutedAmount - q.counted; filled > 0 {
+		quote := filled * order.AvgExecutionPrice
+		if q.side == "buy" {
+			m.report.BaseBought += filled
+			m.report.QuoteSpent += quote
+			m.report.Position += filled
+		} else {
+			m.report.BaseSold += filled
+			m.report.QuoteReceived += quote
+			m.report.Position -= filled
+		}
+
+		q.counted = order.ExecutedAmount
+		recordFill(m.mkt, q.side, filled, order.AvgExecutionPrice)
+		m.printf("%s %v %s @ %v, %s %v\n", blue("Filled"), filled, strings.ToUpper(q.side), order.AvgExecutionPrice, blue("Position"), m.report.Position)
+	}
+
+	*q.order = order
+	if !order.IsLive {
+		q.order = nil
+	}
+}
+
+// cancel cancels the live order of q, if any.
+func (m *marketMaker) cancel(q *mmQuote) error {
+	if q.order == nil {
+		return nil
+	}
+
+	order, err := m.ex.CancelOrder(q.order.OrderId)
+	if err != nil {
+		return fmt.Errorf("%s: %v", q.order.OrderId, err)
+	}
+
+	m.count(q, order)
+	q.order = nil
+
+	return nil
+}
+
+// cancelAll cancels both quotes, returning the last error.
+func (m *marketMaker) cancelAll() error {
+	var lastErr error
+	for _, q := range m.quotes {
+		if err := m.cancel(q); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (m *marketMaker) printf(format string, a ...interface{}) {
+	if m.printUpdates && !quiet {
+		fmt.Fprintf(stdout, format, a...)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jsgoyette/gemini"
+	"github.com/urfave/cli"
+)
+
+// ocoResult is the pair of orders an oco bracket placed, as they stood
+// when the bracket was done with.
+type ocoResult struct {
+	TakeProfit gemini.Order `json:"take_profit"`
+	Stop       gemini.Order `json:"stop"`
+}
+
+// manageBracket polls both orders every interval and cancels the survivor
+// once either one is no longer live, whether it filled or was cancelled
+// elsewhere. A part fill counts too, since what's left of the position no
+// longer covers the other order. When interrupted both orders are left
+// on the book.
+func manageBracket(c *cli.Context, ex exchange, res *ocoResult) error {
+	interval := time.Duration(c.Int("interval")) * time.Second
+
+	for {
+		tp, stop := res.TakeProfit, res.Stop
+
+		if !tp.IsLive || tp.ExecutedAmount > 0 {
+			return cancelSurvivor(ex, &res.Stop)
+		}
+		if !stop.IsLive || stop.ExecutedAmount > 0 {
+			return cancelSurvivor(ex, &res.TakeProfit)
+		}
+
+		err := sleep(interval)
+		if err != nil {
+			slog.Warn("Stopped managing the bracket, both orders are still live",
+				"take_profit", tp.OrderId, "stop", stop.OrderId)
+			return err
+		}
+
+		for _, order := range []*gemini.Order{&res.TakeProfit, &res.Stop} {
+			err := withRetry(func() (err error) {
+				*order, err = ex.OrderStatus(order.OrderId)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// cancelSurvivor cancels order unless it's already done.
+func cancelSurvivor(ex exchange, order *gemini.Order) error {
+	if !order.IsLive {
+		return nil
+	}
+
+	cancelled, err := ex.CancelOrder(order.OrderId)
+	if err != nil {
+		return fmt.Errorf("%s: %s: %v", ERROR_OCO_CANCEL, order.OrderId, err)
+	}
+
+	*order = cancelled
+	return nil
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsgoyette/gemini"
+)
+
+// paperTrade is a simulated fill. The exchange's trades don't carry their
+// market since they're always requested for one.
+type paperTrade struct {
+	Symbol string `json:"symbol"`
+	gemini.Trade
+}
+
+// paperState is the simulated portfolio saved to the paper file between
+// runs. Orders holds every order placed, live or not, and Stops the stop
+// price of each stop-limit order that hasn't triggered yet, by order id.
+type paperState struct {
+	Balances map[string]float64 `json:"balances"`
+	Orders   []gemini.Order     `json:"orders"`
+	Stops    map[string]float64 `json:"stops,omitempty"`
+	Trades   []paperTrade       `json:"trades"`
+	NextId   int64              `json:"next_id"`
+}
+
+// paperExchange simulates orders against an in-memory portfolio, priced
+// off the wrapped exchange's live market data. Orders that cross the book
+// fill right away at the book's levels and pay the taker fee; the rest
+// rest until the ticker trades through their price and pay the maker fee.
+// Stop-limit orders rest the same way once the last price reaches their
+// stop.
+type paperExchange struct {
+	exchange
+	path  string
+	mu    sync.Mutex
+	state paperState
+}
+
+// paperPath returns path, or the paper file in the home directory when
+// none is given.
+func paperPath(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", ERROR_PAPER_FILE, err)
+	}
+
+	return filepath.Join(home, PAPER_FILE_NAME), nil
+}
+
+// openPaper wraps ex so that orders and balances come from the paper
+// portfolio at path. A missing file starts a new portfolio holding
+// PAPER_STARTING_USD.
+func openPaper(path string, ex exchange) (exchange, error) {
+	p := &paperExchange{exchange: ex, path: path}
+
+	chars, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		p.state = paperState{
+			Balances: map[string]float64{"USD": PAPER_STARTING_USD},
+			Stops:    map[string]float64{},
+			NextId:   1,
+		}
+		return p, nil
+	case err != nil:
+		return nil, fmt.Errorf("%s: %v", ERROR_PAPER_FILE, err)
+	}
+
+	if err := json.Unmarshal(chars, &p.state); err != nil {
+		return nil, fmt.Errorf("%s: %v", ERROR_PAPER_FILE, err)
+	}
+
+	if p.state.Balances == nil {
+		p.state.Balances = map[string]float64{}
+	}
+	if p.state.Stops == nil {
+		p.state.Stops = map[string]float64{}
+	}
+
+	return p, nil
+}
+
+// save writes the portfolio through a temporary file so an interrupted
+// write never leaves a truncated one behind.
+func (p *paperExchange) save() error {
+	chars, err := json.MarshalIndent(p.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, chars, 0600); err != nil {
+		return fmt.Errorf("%s: %v", ERROR_PAPER_FILE, err)
+	}
+
+	if err := os.Rename(tmp, p.path); err != nil {
+		return fmt.Errorf("%s: %v", ERROR_PAPER_FILE, err)
+	}
+
+	return nil
+}
+
+// NewOrder fills what it can of the order against the current book. The
+// order options are honored the way the exchange would: maker-or-cancel
+// is cancelled if it would take, fill-or-kill unless it fills completely
+// and immediate-or-cancel drops whatever doesn't fill.
+func (p *paperExchange) NewOrder(symbol, clientOrderId string, amount, price float64, side string, options []string) (gemini.Order, error) {
+	details, err := getSymbolDetails(symbol)
+	if err != nil {
+		return gemini.Order{}, err
+	}
+
+	book, err := p.exchange.OrderBook(symbol, 0, 0)
+	if err != nil {
+		return gemini.Order{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.settle(); err != nil {
+		return gemini.Order{}, err
+	}
+
+	if err := p.checkFunds(details, side, amount, price); err != nil {
+		return gemini.Order{}, err
+	}
+
+	order := gemini.Order{
+		OrderId:         strconv.FormatInt(p.state.NextId, 10),
+		ClientOrderId:   clientOrderId,
+		Symbol:          strings.ToLower(symbol),
+		Exchange:        "gemini",
+		Price:           price,
+		Side:            side,
+		Type:            "exchange limit",
+		Options:         options,
+		Timestamp:       time.Now().Unix(),
+		IsLive:          true,
+		OriginalAmount:  amount,
+		RemainingAmount: amount,
+	}
+	p.state.NextId++
+
+	levels := book.Asks
+	crosses := func(level gemini.BookEntry) bool { return level.Price <= price }
+	if side == "sell" {
+		levels = book.Bids
+		crosses = func(level gemini.BookEntry) bool { return level.Price >= price }
+	}
+
+	var fills []gemini.BookEntry
+	fillable := 0.0
+	for _, level := range levels {
+		if fillable >= amount || !crosses(level) {
+			break
+		}
+
+		fill := level
+		if fill.Amount > amount-fillable {
+			fill.Amount = amount - fillable
+		}
+
+		fills = append(fills, fill)
+		fillable += fill.Amount
+	}
+
+	cancel := (hasOption(options, "maker-or-cancel") && len(fills) > 0) ||
+		(hasOption(options, "fill-or-kill") && fillable < amount)
+
+	if !cancel {
+		for _, fill := range fills {
+			p.fill(&order, details, fill.Amount, fill.Price, PAPER_TAKER_FEE_BPS, true)
+		}
+		cancel = order.RemainingAmount > 0 && hasOption(options, "immediate-or-cancel")
+	}
+
+	if cancel {
+		order.IsLive = false
+		order.IsCancelled = true
+	}
+
+	p.state.Orders = append(p.state.Orders, order)
+
+	return order, p.save()
+}
+
+// StopLimitOrder places a stop-limit order without filling any of it;
+// settle turns it into a limit order once the stop triggers. Its funds are
+// held from the start, as they are on the exchange.
+func (p *paperExchange) StopLimitOrder(symbol, clientOrderId string, amount, stopPrice, price float64, side string) (gemini.Order, error) {
+	details, err := getSymbolDetails(symbol)
+	if err != nil {
+		return gemini.Order{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.settle(); err != nil {
+		return gemini.Order{}, err
+	}
+
+	if err := p.checkFunds(details, side, amount, price); err != nil {
+		return gemini.Order{}, err
+	}
+
+	order := gemini.Order{
+		OrderId:         strconv.FormatInt(p.state.NextId, 10),
+		ClientOrderId:   clientOrderId,
+		Symbol:          strings.ToLower(symbol),
+		Exchange:        "gemini",
+		Price:           price,
+		Side:            side,
+		Type:            "exchange stop limit",
+		Timestamp:       time.Now().Unix(),
+		IsLive:          true,
+		OriginalAmount:  amount,
+		RemainingAmount: amount,
+	}
+	p.state.NextId++
+
+	p.state.Orders = append(p.state.Orders, order)
+	p.state.Stops[order.OrderId] = stopPrice
+
+	return order, p.save()
+}
+
+// CancelOrder cancels a live paper order.
+func (p *paperExchange) CancelOrder(orderId string) (gemini.Order, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.settle(); err != nil {
+		return gemini.Order{}, err
+	}
+
+	for i := range p.state.Orders {
+		order := &p.state.Orders[i]
+		if order.OrderId != orderId || !order.IsLive {
+			continue
+		}
+
+		order.IsLive = false
+		order.IsCancelled = true
+		delete(p.state.Stops, order.OrderId)
+
+		return *order, p.save()
+	}
+
+	return gemini.Order{}, paperOrderNotFound(orderId)
+}
+
+// CancelAll cancels every live paper order.
+func (p *paperExchange) CancelAll() (gemini.CancelResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.settle(); err != nil {
+		return gemini.CancelResult{}, err
+	}
+
+	res := gemini.CancelResult{Result: "ok"}
+	for i := range p.state.Orders {
+		order := &p.state.Orders[i]
+		if !order.IsLive {
+			continue
+		}
+
+		order.IsLive = false
+		order.IsCancelled = true
+		delete(p.state.Stops, order.OrderId)
+		res.Details.CancelledOrders = append(res.Details.CancelledOrders, order.OrderId)
+	}
+
+	return res, p.save()
+}
+
+// OrderStatus returns the paper order, live or not.
+func (p *paperExchange) OrderStatus(orderId string) (gemini.Order, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.settle(); err != nil {
+		return gemini.Order{}, err
+	}
+
+	for _, order := range p.state.Orders {
+		if order.OrderId == orderId {
+			return order, nil
+		}
+	}
+
+	return gemini.Order{}, paperOrderNotFound(orderId)
+}
+
+// ActiveOrders returns the live paper orders.
+func (p *paperExchange) ActiveOrders() ([]gemini.Order, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.settle(); err != nil {
+		return nil, err
+	}
+
+	orders := []gemini.Order{}
+	for _, order := range p.state.Orders {
+		if order.IsLive {
+			orders = append(orders, order)
+		}
+	}
+
+	return orders, nil
+}
+
+// Balances returns the paper balances. Funds held by live orders aren't
+// available.
+func (p *paperExchange) Balances() ([]gemini.FundBalance, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.settle(); err != nil {
+		return nil, err
+	}
+
+	balances := make([]gemini.FundBalance, 0, len(p.state.Balances))
+	for currency, amount := range p.state.Balances {
+		held, err := p.held(currency)
+		if err != nil {
+			return nil, err
+		}
+
+		balances = append(balances, gemini.FundBalance{
+			Currency:               currency,
+			Amount:                 amount,
+			Available:              amount - held,
+			AvailableForWithdrawal: amount - held,
+		})
+	}
+
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].Currency < balances[j].Currency
+	})
+
+	return balances, nil
+}
+
+// PastTrades returns the paper fills in symbol at or after timestamp, in
+// milliseconds, newest first.
+func (p *paperExchange) PastTrades(symbol string, limitTrades int, timestamp int64) ([]gemini.Trade, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.settle(); err != nil {
+		return nil, err
+	}
+
+	trades := []gemini.Trade{}
+	for i := len(p.state.Trades) - 1; i >= 0; i-- {
+		trade := p.state.Trades[i]
+		if !strings.EqualFold(trade.Symbol, symbol) || trade.Timestamp*1000 < timestamp {
+			continue
+		}
+
+		trades = append(trades, trade.Trade)
+		if limitTrades > 0 && len(trades) >= limitTrades {
+			break
+		}
+	}
+
+	return trades, nil
+}
+
+func (p *paperExchange) NewDepositAddress(currency, label string) (gemini.DepositAddressResult, error) {
+	return gemini.DepositAddressResult{}, errors.New(ERROR_PAPER_MODE)
+}
+
+func (p *paperExchange) WithdrawFunds(currency, address string, amount float64) (gemini.WithdrawFundsResult, error) {
+	return gemini.WithdrawFundsResult{}, errors.New(ERROR_PAPER_MODE)
+}
+
+// settle fills the live orders the market has traded through since they
+// were placed, at their limit price, after first triggering the stop-limit
+// orders whose stop the last price has reached. Only the ticker is
+// checked, so a resting order always fills completely.
+func (p *paperExchange) settle() error {
+	tickers := map[string]gemini.Ticker{}
+	changed := false
+
+	for i := range p.state.Orders {
+		order := &p.state.Orders[i]
+		if !order.IsLive {
+			continue
+		}
+
+		ticker, ok := tickers[order.Symbol]
+		if !ok {
+			var err error
+			ticker, err = p.exchange.Ticker(order.Symbol)
+			if err != nil {
+				return err
+			}
+			tickers[order.Symbol] = ticker
+		}
+
+		if stop, ok := p.state.Stops[order.OrderId]; ok {
+			if (order.Side == "buy" && ticker.Last < stop) ||
+				(order.Side == "sell" && ticker.Last > stop) {
+				continue
+			}
+
+			delete(p.state.Stops, order.OrderId)
+			changed = true
+		}
+
+		if (order.Side == "buy" && (ticker.Ask <= 0 || ticker.Ask > order.Price)) ||
+			(order.Side == "sell" && ticker.Bid < order.Price) {
+			continue
+		}
+
+		details, err := getSymbolDetails(order.Symbol)
+		if err != nil {
+			return err
+		}
+
+		p.fill(order, details, order.RemainingAmount, order.Price, PAPER_MAKER_FEE_BPS, false)
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return p.save()
+}
+
+// fill executes amount of order at price, moving the funds between the
+// market's currencies and charging the fee in the quote currency.
+func (p *paperExchange) fill(order *gemini.Order, details *symbolDetails, amount, price float64, feeBps int, aggressor bool) {
+	base := strings.ToUpper(details.BaseCurrency)
+	quote := strings.ToUpper(details.QuoteCurrency)
+
+	notional := amount * price
+	fee := notional * float64(feeBps) / 10000
+
+	tradeType := "Buy"
+	if order.Side == "buy" {
+		p.state.Balances[base] += amount
+		p.state.Balances[quote] -= notional + fee
+	} else {
+		tradeType = "Sell"
+		p.state.Balances[base] -= amount
+		p.state.Balances[quote] += notional - fee
+	}
+
+	executed := order.ExecutedAmount + amount
+	order.AvgExecutionPrice = (order.AvgExecutionPrice*order.ExecutedAmount + notional) / executed
+	order.ExecutedAmount = executed
+	order.RemainingAmount = order.OriginalAmount - executed
+	if order.RemainingAmount <= 0 {
+		order.RemainingAmount = 0
+		order.IsLive = false
+	}
+
+	p.state.Trades = append(p.state.Trades, paperTrade{
+		Symbol: order.Symbol,
+		Trade: gemini.Trade{
+			Timestamp:   time.Now().Unix(),
+			TradeId:     strconv.FormatInt(p.state.NextId, 10),
+			Price:       price,
+			Amount:      amount,
+			Exchange:    "gemini",
+			Type:        tradeType,
+			Aggressor:   aggressor,
+			FeeCurrency: quote,
+			FeeAmount:   fee,
+			OrderId:     order.OrderId,
+		},
+	})
+	p.state.NextId++
+}
+
+// checkFunds fails with the exchange's own InsufficientFunds error when
+// the balance not held by live orders can't cover the order and its fee.
+func (p *paperExchange) checkFunds(details *symbolDetails, side string, amount, price float64) error {
+	currency := strings.ToUpper(details.BaseCurrency)
+	needed := amount
+	if side == "buy" {
+		currency = strings.ToUpper(details.QuoteCurrency)
+		needed = amount * price * (1 + float64(PAPER_TAKER_FEE_BPS)/10000)
+	}
+
+	held, err := p.held(currency)
+	if err != nil {
+		return err
+	}
+
+	available := p.state.Balances[currency] - held
+	if needed > available {
+		return &apiError{
+			Result:  "error",
+			Reason:  "InsufficientFunds",
+			Message: fmt.Sprintf("%v %s needed, %v available", needed, currency, available),
+		}
+	}
+
+	return nil
+}
+
+// held totals currency tied up in live orders: the quote amount of buys
+// and the base amount of sells.
+func (p *paperExchange) held(currency string) (float64, error) {
+	held := 0.0
+
+	for _, order := range p.state.Orders {
+		if !order.IsLive {
+			continue
+		}
+
+		details, err := getSymbolDetails(order.Symbol)
+		if err != nil {
+			return 0, err
+		}
+
+		switch {
+		case order.Side == "buy" && strings.EqualFold(details.QuoteCurrency, currency):
+			held += order.RemainingAmount * order.Price * (1 + float64(PAPER_MAKER_FEE_BPS)/10000)
+		case order.Side == "sell" && strings.EqualFold(details.BaseCurrency, currency):
+			held += order.RemainingAmount
+		}
+	}
+
+	return held, nil
+}
+
+func hasOption(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+func paperOrderNotFound(orderId string) error {
+	return &apiError{Result: "error", Reason: "OrderNotFound", Message: orderId}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jsgoyette/gemini"
+)
+
+type lot struct {
+	Amount float64
+	Price  float64
+}
+
+// fifoLedger tracks an open position as lots of buys, matching each sell
+// against the oldest lots first.
+type fifoLedger struct {
+	lots      []lot
+	realized  float64
+	unmatched float64
+}
+
+type pnlReport struct {
+	Market      string  `json:"market"`
+	Trades      int     `json:"trades"`
+	RealizedPnl float64 `json:"realized_pnl"`
+	Fees        float64 `json:"fees"`
+	Position    float64 `json:"position"`
+	AvgCost     float64 `json:"avg_cost"`
+	Unmatched   float64 `json:"unmatched"`
+}
+
+func (l *fifoLedger) buy(amount, price float64) {
+	l.lots = append(l.lots, lot{amount, price})
+}
+
+// position returns the open amount and its average cost.
+func (l *fifoLedger) position() (float64, float64) {
+	amount, cost := 0.0, 0.0
+	for _, open := range l.lots {
+		amount += open.Amount
+		cost += open.Amount * open.Price
+	}
+
+	if amount == 0 {
+		return 0, 0
+	}
+	return amount, cost / amount
+}
+
+// sell realizes the difference between price and the cost of the oldest
+// lots. Anything sold beyond the open position is counted as unmatched.
+func (l *fifoLedger) sell(amount, price float64) {
+	for amount > 0 && len(l.lots) > 0 {
+		open := &l.lots[0]
+
+		matched := amount
+		if open.Amount < matched {
+			matched = open.Amount
+		}
+
+		l.realized += (price - open.Price) * matched
+		open.Amount -= matched
+		amount -= matched
+
+		if open.Amount <= 0 {
+			l.lots = l.lots[1:]
+		}
+	}
+
+	l.unmatched += amount
+}
+
+// computePnl replays trades oldest first through a FIFO ledger.
+func computePnl(mkt string, trades []gemini.Trade) pnlReport {
+	sorted := make([]gemini.Trade, len(trades))
+	copy(sorted, trades)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp < sorted[j].Timestamp
+	})
+
+	ledger := &fifoLedger{}
+	report := pnlReport{Market: mkt, Trades: len(sorted)}
+
+	for _, trade := range sorted {
+		if strings.EqualFold(trade.Type, "buy") {
+			ledger.buy(trade.Amount, trade.Price)
+		} else {
+			ledger.sell(trade.Amount, trade.Price)
+		}
+		report.Fees += trade.FeeAmount
+	}
+
+	report.RealizedPnl = ledger.realized
+	report.Position, report.AvgCost = ledger.position()
+	report.Unmatched = ledger.unmatched
+
+	return report
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/jsgoyette/gemini"
+)
+
+type holding struct {
+	Currency string  `json:"currency"`
+	Amount   float64 `json:"amount"`
+	Price    float64 `json:"price"`
+	Value    float64 `json:"value"`
+	Priced   bool    `json:"priced"`
+}
+
+type portfolioReport struct {
+	Quote    string    `json:"quote"`
+	Holdings []holding `json:"holdings"`
+	Total    float64   `json:"total"`
+}
+
+// rateBook prices one currency in another from last trade prices, fetching
+// each market's ticker at most once.
+type rateBook struct {
+	ex      exchange
+	symbols []string
+	last    map[string]float64
+}
+
+func newRateBook(ex exchange, symbols []string) *rateBook {
+	return &rateBook{ex: ex, symbols: symbols, last: map[string]float64{}}
+}
+
+// find returns the holding for currency. It's safe to call on a nil
+// report.
+func (p *portfolioReport) find(currency string) (holding, bool) {
+	if p == nil {
+		return holding{}, false
+	}
+
+	for _, h := range p.Holdings {
+		if strings.EqualFold(h.Currency, currency) {
+			return h, true
+		}
+	}
+
+	return holding{}, false
+}
+
+func (r *rateBook) hasSymbol(symbol string) bool {
+	for _, s := range r.symbols {
+		if s == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rateBook) lastPrice(symbol string) (float64, error) {
+	if price, ok := r.last[symbol]; ok {
+		return price, nil
+	}
+
+	var t gemini.Ticker
+	err := withRetry(func() (err error) {
+		t, err = r.ex.Ticker(symbol)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	r.last[symbol] = t.Last
+	return t.Last, nil
+}
+
+// direct prices one currency in another through a single market, in
+// either direction.
+func (r *rateBook) direct(from, to string) (float64, bool, error) {
+	if from == to {
+		return 1, true, nil
+	}
+
+	if r.hasSymbol(from + to) {
+		price, err := r.lastPrice(from + to)
+		return price, price > 0, err
+	}
+
+	if r.hasSymbol(to + from) {
+		price, err := r.lastPrice(to + from)
+		if err != nil || price == 0 {
+			return 0, false, err
+		}
+		return 1 / price, true, nil
+	}
+
+	return 0, false, nil
+}
+
+// rate is like direct but goes through one intermediate currency (e.g.
+// ethbtc * btcusd) when there is no direct market. The bool is false when
+// no route exists.
+func (r *rateBook) rate(from, to string) (float64, bool, error) {
+	price, ok, err := r.direct(from, to)
+	if ok || err != nil {
+		return price, ok, err
+	}
+
+	for _, symbol := range r.symbols {
+		if !strings.HasPrefix(symbol, from) {
+			continue
+		}
+
+		via := strings.TrimPrefix(symbol, from)
+
+		second, ok, err := r.direct(via, to)
+		if err != nil {
+			return 0, false, err
+		}
+		if !ok {
+			continue
+		}
+
+		first, ok, err := r.direct(from, via)
+		if err != nil {
+			return 0, false, err
+		}
+		if ok {
+			return first * second, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
+
+// valuePortfolio prices each nonzero balance in quote. Balances that can't
+// be priced are included in the report with Priced set to false and left
+// out of the total.
+func valuePortfolio(ex exchange, balances []gemini.FundBalance, quote string) (*portfolioReport, error) {
+	symbols, err := getSymbols(ex)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := newRateBook(ex, symbols)
+	report := &portfolioReport{Quote: quote, Holdings: []holding{}}
+
+	for _, fund := range balances {
+		if fund.Amount == 0 {
+			continue
+		}
+
+		currency := strings.ToLower(fund.Currency)
+		price, ok, err := rates.rate(currency, quote)
+		if err != nil {
+			return nil, err
+		}
+
+		h := holding{Currency: currency, Amount: fund.Amount, Priced: ok}
+		if ok {
+			h.Price = price
+			h.Value = fund.Amount * price
+			report.Total += h.Value
+		}
+
+		report.Holdings = append(report.Holdings, h)
+	}
+
+	return report, nil
+}
@@ -1,128 +1,829 @@
 package main
 
 import (
+	"time"
+
 	"github.com/urfave/cli"
 )
 
 var (
+	addressFlag = cli.StringFlag{
+		Name:  "address",
+		Value: "",
+		Usage: "Destination address",
+	}
+	aboveFlag = cli.Float64Flag{
+		Name:  "above",
+		Value: 0,
+		Usage: "Trigger when the last price is at or above this",
+	}
+	allFlag = cli.BoolFlag{
+		Name:  "all",
+		Usage: "Page through the full history: true, false (default false)",
+	}
 	amtFlag = cli.Float64Flag{
 		Name:  "amt, a",
 		Value: 0,
 		Usage: "Amount of quote currency",
 	}
+	appendFlag = cli.BoolFlag{
+		Name:  "append",
+		Usage: "Append to the --out file instead of truncating it: true, false (default false)",
+	}
+	apiUrlFlag = cli.StringFlag{
+		Name:   "api-url",
+		Value:  "",
+		Usage:  "Base URL to send API requests to instead of the live or sandbox exchange",
+		EnvVar: "GEMINI_API_URL",
+	}
+	askLimitFlag = cli.IntFlag{
+		Name:  "ask-lim",
+		Value: 0,
+		Usage: "Limit of asks, defaults to lim",
+	}
+	auditLogFlag = cli.StringFlag{
+		Name:  "audit-log",
+		Usage: "Append a JSON line to this file before and after every order is submitted",
+	}
+	availableOnlyFlag = cli.BoolFlag{
+		Name:  "available-only",
+		Usage: "Print only the available amount of --currency: true, false (default false)",
+	}
+	belowFlag = cli.Float64Flag{
+		Name:  "below",
+		Value: 0,
+		Usage: "Trigger when the last price is at or below this",
+	}
+	bidLimitFlag = cli.IntFlag{
+		Name:  "bid-lim",
+		Value: 0,
+		Usage: "Limit of bids, defaults to lim",
+	}
 	bpsFlag = cli.IntFlag{
 		Name:  "bps",
-		Value: 100,
-		Usage: "Fee Basis points",
+		Value: 0,
+		Usage: "Deprecated, sets both maker-bps and taker-bps",
 	}
 	baseAmtFlag = cli.Float64Flag{
 		Name:  "base-amt, A",
 		Value: 0,
 		Usage: "Amount of base currency",
 	}
+	backtestFeeFlag = cli.IntFlag{
+		Name:  "fee-bps",
+		Value: PAPER_TAKER_FEE_BPS,
+		Usage: "Fee in basis points charged on each simulated trade",
+	}
+	capitalFlag = cli.Float64Flag{
+		Name:  "capital",
+		Value: PAPER_STARTING_USD,
+		Usage: "Quote amount the backtest starts with",
+	}
+	candleIntervalFlag = cli.StringFlag{
+		Name:  "interval, i",
+		Value: "1hr",
+		Usage: "Candle interval: 1m, 5m, 15m, 30m, 1hr, 6hr, 1day",
+	}
+	closeSideFlag = cli.StringFlag{
+		Name:  "side, s",
+		Value: "sell",
+		Usage: "Side: sell to close a long position, buy to close a short",
+	}
+	clientOrderIdFlag = cli.StringFlag{
+		Name:  "client-order-id",
+		Value: "",
+		Usage: "Client order id to tag or look up orders with (default a new UUID when placing)",
+	}
+	configFlag = cli.StringFlag{
+		Name:  "config",
+		Value: "",
+		Usage: "Path to config file (default ~/" + CONFIG_FILE_NAME + ")",
+	}
+	countFlag = cli.IntFlag{
+		Name:  "count",
+		Value: 0,
+		Usage: "Number of rounds, 0 runs until interrupted",
+	}
+	csvFlag = cli.BoolFlag{
+		Name:  "csv",
+		Usage: "Return in CSV format: true, false (default false)",
+	}
+	convertFieldFlag = cli.StringFlag{
+		Name:  "field",
+		Value: "mid",
+		Usage: "Price to convert at: mid, bid, ask, last",
+	}
+	cumulativeFlag = cli.BoolFlag{
+		Name:  "cumulative",
+		Usage: "Show running amount and notional totals: true, false (default false)",
+	}
+	currencyFlag = cli.StringFlag{
+		Name:  "currency, c",
+		Value: "",
+		Usage: "Currency: btc, eth",
+	}
 	dateFlag = cli.StringFlag{
 		Name:  "date, T",
 		Value: "",
 		Usage: "Date (in format of YYYY-MM-DD) for date query",
 	}
+	debugFlag = cli.BoolFlag{
+		Name:  "debug",
+		Usage: "Log HTTP requests and responses to stderr: true, false (default false)",
+	}
+	descFlag = cli.BoolFlag{
+		Name:  "desc",
+		Usage: "Sort in descending order: true, false (default false)",
+	}
+	dryRunFlag = cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Validate without placing or cancelling orders: true, false (default false)",
+	}
+	dcaIntervalFlag = cli.DurationFlag{
+		Name:  "interval",
+		Value: 24 * time.Hour,
+		Usage: "Time between rounds (e.g. 1h, 24h)",
+	}
+	durationFlag = cli.DurationFlag{
+		Name:  "duration",
+		Value: time.Hour,
+		Usage: "Time to spread the slices over (e.g. 30m, 4h)",
+	}
+	epochFlag = cli.BoolFlag{
+		Name:  "epoch",
+		Usage: "Print timestamps as raw epoch numbers: true, false (default false)",
+	}
+	feeBpsFlag = cli.IntFlag{
+		Name:  "bps",
+		Value: 0,
+		Usage: "Fee in basis points to include in the estimate",
+	}
+	fieldFlag = cli.StringFlag{
+		Name:  "field",
+		Value: "mid",
+		Usage: "Price to print: mid, bid, ask, last",
+	}
+	fieldsFlag = cli.StringFlag{
+		Name:  "fields",
+		Value: "",
+		Usage: "Comma separated columns to include in table or CSV output, in order (e.g. Timestamp,Price,Amount)",
+	}
+	fileFlag = cli.StringFlag{
+		Name:  "file, f",
+		Value: "",
+		Usage: "Path of a JSON or CSV file of orders (mkt, side, amt, base-amt, price, type)",
+	}
+	formatFlag = cli.StringFlag{
+		Name:  "format",
+		Value: "",
+		Usage: "Go template applied to each result in place of JSON, e.g. '{{.Price}} {{.Amount}}', see a command's help for its fields",
+	}
+	forceFlag = cli.BoolFlag{
+		Name:  "force",
+		Usage: "Place the order even if it's beyond max-deviation: true, false (default false)",
+	}
+	fromFlag = cli.StringFlag{
+		Name:  "from",
+		Value: "",
+		Usage: "Start date (in format of YYYY-MM-DD) of range query",
+	}
+	fromPriceFlag = cli.Float64Flag{
+		Name:  "from",
+		Value: 0,
+		Usage: "Price of the first order",
+	}
+	geometricFlag = cli.BoolFlag{
+		Name:  "geometric",
+		Usage: "Space prices by a constant ratio instead of a constant step: true, false (default false)",
+	}
+	intervalFlag = cli.IntFlag{
+		Name:  "interval, i",
+		Value: 5,
+		Usage: "Seconds between refreshes in watch, wait or alert mode",
+	}
 	jsonFlag = cli.BoolFlag{
 		Name:  "json, j",
 		Usage: "Return in JSON format: true, false (default false)",
 	}
+	keyFileFlag = cli.StringFlag{
+		Name:  "key-file",
+		Usage: "Read the API key from this file, ahead of the environment and config file",
+	}
+	labelFlag = cli.StringFlag{
+		Name:  "label",
+		Value: "",
+		Usage: "Label for deposit address",
+	}
 	limitFlag = cli.IntFlag{
 		Name:  "lim, l",
 		Value: 20,
 		Usage: "Limit for list query",
 	}
+	limitTifFlag = cli.StringFlag{
+		Name:  "tif",
+		Value: "maker-or-cancel",
+		Usage: "Execution option: maker-or-cancel, immediate-or-cancel, fill-or-kill, auction-only",
+	}
 	liveFlag = cli.BoolFlag{
 		Name:  "live",
 		Usage: "Live mode: true, false (default false)",
 	}
+	logLevelFlag = cli.StringFlag{
+		Name:  "log-level",
+		Value: "warn",
+		Usage: "Level of diagnostic messages logged to stderr: debug, info, warn, error",
+	}
+	maxBookAgeFlag = cli.DurationFlag{
+		Name:  "max-book-age",
+		Value: 5 * time.Minute,
+		Usage: "Refuse to price orders off a book whose best levels are all older than this, 0 disables",
+	}
+	maxRequotesFlag = cli.IntFlag{
+		Name:  "max-requotes",
+		Value: REQUOTES_MAX,
+		Usage: "Most orders to sweep the book with when unsafe",
+	}
+	maxRetriesFlag = cli.IntFlag{
+		Name:  "max-retries",
+		Value: 3,
+		Usage: "Retries for rate limited or failed read requests",
+	}
+	makerBpsFlag = cli.IntFlag{
+		Name:  "maker-bps",
+		Usage: "Maker fee basis points. When not passed, --bps, the config file bps or the account maker fee is used, in that order",
+	}
+	marketTifFlag = cli.StringFlag{
+		Name:  "tif",
+		Value: "immediate-or-cancel",
+		Usage: "Execution option: maker-or-cancel, immediate-or-cancel, fill-or-kill, auction-only",
+	}
+	maxDeviationFlag = cli.Float64Flag{
+		Name:  "max-deviation",
+		Value: 0,
+		Usage: "Reject the order if its price is more than this percent from the mid, 0 for no limit",
+	}
+	maxPositionFlag = cli.Float64Flag{
+		Name:  "max-position",
+		Usage: "Largest base amount to be long or short, beyond which only the side that reduces it is quoted",
+	}
+	maxSlippageFlag = cli.Float64Flag{
+		Name:  "max-slippage",
+		Value: 0,
+		Usage: "Skip slices while the price is this many bps worse than at the start, 0 for no limit",
+	}
+	metricsAddrFlag = cli.StringFlag{
+		Name:  "metrics-addr",
+		Usage: "Serve Prometheus metrics at /metrics on this address while running, e.g. :9100",
+	}
 	mktFlag = cli.StringFlag{
 		Name:  "mkt, m",
 		Value: "btcusd",
-		Usage: "Market: btcusd, ethusd, ethbtc",
+		Usage: "Market symbol, see the symbols command",
+	}
+	newFlag = cli.BoolFlag{
+		Name:  "new",
+		Usage: "Request a fresh address: true, false (default false)",
+	}
+	noColorFlag = cli.BoolFlag{
+		Name:  "no-color",
+		Usage: "Disable colored output: true, false (default false)",
+	}
+	noRetryFlag = cli.BoolFlag{
+		Name:  "no-retry",
+		Usage: "Send a single order at the best price, even when unsafe: true, false (default false)",
+	}
+	nonzeroFlag = cli.BoolFlag{
+		Name:  "nonzero",
+		Usage: "Hide empty balances: true, false (default false)",
+	}
+	olderThanFlag = cli.DurationFlag{
+		Name:  "older-than",
+		Value: 0,
+		Usage: "Only orders placed at least this long ago (e.g. 30m, 2h)",
+	}
+	ordersFlag = cli.IntFlag{
+		Name:  "orders",
+		Value: 5,
+		Usage: "Number of orders in the ladder",
+	}
+	outFlag = cli.StringFlag{
+		Name:  "out",
+		Value: "",
+		Usage: "Write output to a file instead of stdout, errors still go to stderr",
+	}
+	paperFlag = cli.BoolFlag{
+		Name:  "paper",
+		Usage: "Simulate orders and balances locally against live prices, no API keys needed",
+	}
+	paperFileFlag = cli.StringFlag{
+		Name:  "paper-file",
+		Usage: "File the paper portfolio is kept in (default ~/" + PAPER_FILE_NAME + ")",
+	}
+	pctFlag = cli.Float64Flag{
+		Name:  "pct",
+		Value: 0,
+		Usage: "Percent of the available balance to spend, quote currency for buys and base for sells",
+	}
+	precisionFlag = cli.IntFlag{
+		Name:  "precision",
+		Value: 8,
+		Usage: "Decimal places of prices and amounts in text, table and CSV output",
+	}
+	prettyFlag = cli.BoolFlag{
+		Name:  "pretty",
+		Usage: "Indent JSON output: true, false (default false)",
 	}
 	priceFlag = cli.Float64Flag{
 		Name:  "price, p",
 		Value: 0,
 		Usage: "Price of parent denomination",
 	}
+	profileFlag = cli.StringFlag{
+		Name:  "profile",
+		Value: DEFAULT_PROFILE,
+		Usage: "Named profile from the config file",
+	}
+	quietFlag = cli.BoolFlag{
+		Name:  "quiet",
+		Usage: "Print only essential results, such as order ids: true, false (default false)",
+	}
+	quoteFlag = cli.StringFlag{
+		Name:  "quote, q",
+		Value: "usd",
+		Usage: "Currency to value holdings in",
+	}
+	refreshFlag = cli.BoolFlag{
+		Name:  "refresh",
+		Usage: "Fetch the markets again rather than reading them from the cache: true, false (default false)",
+	}
+	refreshSymbolsFlag = cli.BoolFlag{
+		Name:  "refresh-symbols",
+		Usage: "Fetch symbols and symbol details again rather than reading them from the cache: true, false (default false)",
+	}
+	repriceBpsFlag = cli.Float64Flag{
+		Name:  "reprice-bps",
+		Value: 5,
+		Usage: "Replace a quote once the mid has moved this many bps from where it was priced",
+	}
+	requireHeartbeatFlag = cli.BoolFlag{
+		Name:  "require-heartbeat",
+		Usage: "Send heartbeats while running, for API keys whose sessions require them: true, false (default false)",
+	}
+	requestTimeoutFlag = cli.DurationFlag{
+		Name:  "request-timeout",
+		Value: 30 * time.Second,
+		Usage: "Timeout of each API request, 0 waits indefinitely",
+	}
+	secretFileFlag = cli.StringFlag{
+		Name:  "secret-file",
+		Usage: "Read the API secret from this file, ahead of the environment and config file",
+	}
+	secretStdinFlag = cli.BoolFlag{
+		Name:  "secret-stdin",
+		Usage: "Read the API secret from the first line of stdin: true, false (default false)",
+	}
+	smaCrossFlag = cli.StringFlag{
+		Name:  "sma-cross",
+		Usage: "Buy when the fast simple moving average crosses above the slow one and sell when it crosses below, as fast,slow candle counts, e.g. 10,20",
+	}
 	sideFlag = cli.StringFlag{
 		Name:  "side, s",
 		Value: "buy",
 		Usage: "Side: buy, sell",
 	}
+	slicesFlag = cli.IntFlag{
+		Name:  "slices",
+		Value: 10,
+		Usage: "Number of slices to split the order into",
+	}
+	sortFlag = cli.StringFlag{
+		Name:  "sort",
+		Value: "",
+		Usage: "Sort by price, amount or timestamp",
+	}
+	spreadBpsFlag = cli.Float64Flag{
+		Name:  "spread-bps",
+		Value: 20,
+		Usage: "Width of the quote in bps of the mid, half of it on each side",
+	}
+	stopFlag = cli.Float64Flag{
+		Name:  "stop",
+		Usage: "Price that triggers the stop-limit order",
+	}
+	stopLimitFlag = cli.Float64Flag{
+		Name:  "stop-limit",
+		Usage: "Limit price of the stop-limit order once triggered, defaults to the stop price",
+	}
+	stdinFlag = cli.BoolFlag{
+		Name:  "stdin",
+		Usage: "Read JSON order specs from stdin, one per line, over the flags (keys mkt, side, amt, base_amt, price): true, false (default false)",
+	}
+	strictFlag = cli.BoolFlag{
+		Name:  "strict",
+		Usage: "Reject a price off the market's price increment instead of rounding it: true, false (default false)",
+	}
+	stopOnErrorFlag = cli.BoolFlag{
+		Name:  "stop-on-error",
+		Usage: "Stop the schedule at the first failed round: true, false (default false)",
+	}
+	summaryOnlyFlag = cli.BoolFlag{
+		Name:  "summary-only",
+		Usage: "Print only the totals of the trades, fees by fee currency and volume by side: true, false (default false)",
+	}
+	tableFlag = cli.BoolFlag{
+		Name:  "table",
+		Usage: "Return as an aligned table: true, false (default false)",
+	}
+	takerBpsFlag = cli.IntFlag{
+		Name:  "taker-bps",
+		Usage: "Taker fee basis points. When not passed, --bps, the config file bps or the account taker fee is used, in that order",
+	}
+	takeProfitFlag = cli.Float64Flag{
+		Name:  "take-profit",
+		Usage: "Price of the take-profit limit order",
+	}
+	thresholdFlag = cli.Float64Flag{
+		Name:  "threshold",
+		Value: 0.5,
+		Usage: "Percent gap between the implied and direct price to flag",
+	}
 	timeFlag = cli.Int64Flag{
 		Name:  "time, t",
 		Value: 0,
 		Usage: "Timestamp (with milliseconds) for date query",
 	}
+	timeoutFlag = cli.DurationFlag{
+		Name:  "timeout",
+		Value: 0,
+		Usage: "Give up waiting after this long (e.g. 10m), 0 waits indefinitely",
+	}
+	toFlag = cli.StringFlag{
+		Name:  "to",
+		Value: "",
+		Usage: "End date (in format of YYYY-MM-DD, inclusive) of range query",
+	}
+	toPriceFlag = cli.Float64Flag{
+		Name:  "to",
+		Value: 0,
+		Usage: "Price of the last order",
+	}
+	trailFlag = cli.StringFlag{
+		Name:  "trail",
+		Usage: "Distance the trigger trails the best price by, as a price or a percentage, e.g. 50 or 2%",
+	}
 	txidFlag = cli.StringFlag{
 		Name:  "txid, x",
 		Value: "",
 		Usage: "Id of order",
 	}
+	typeFlag = cli.StringFlag{
+		Name:  "type",
+		Value: "market",
+		Usage: "Order type: market, limit (maker-or-cancel at the best bid)",
+	}
+	tzFlag = cli.StringFlag{
+		Name:  "tz",
+		Value: "",
+		Usage: "Timezone (IANA name, e.g. America/New_York) for date query (default local)",
+	}
 	unsafeFlag = cli.BoolFlag{
 		Name:  "unsafe",
 		Usage: "Continue filling after partial orders: true, false (default false)",
 	}
+	utcFlag = cli.BoolFlag{
+		Name:  "utc",
+		Usage: "Print timestamps in UTC rather than local time: true, false (default false)",
+	}
+	waitFlag = cli.BoolFlag{
+		Name:  "wait",
+		Usage: "Poll until the order is filled or cancelled: true, false (default false)",
+	}
+	watchFlag = cli.BoolFlag{
+		Name:  "watch, w",
+		Usage: "Refresh continuously until interrupted: true, false (default false)",
+	}
+	webhookFlag = cli.StringFlag{
+		Name:  "webhook",
+		Usage: "URL to POST a JSON notification to whenever an order fills",
+	}
+	webhookSecretFlag = cli.StringFlag{
+		Name:   "webhook-secret",
+		Usage:  "Secret to sign webhook payloads with, sent as an HMAC-SHA256 in X-Webhook-Signature",
+		EnvVar: "GEMINI_CLI_WEBHOOK_SECRET",
+	}
+	windowFlag = cli.DurationFlag{
+		Name:  "window",
+		Value: time.Hour,
+		Usage: "How far back to sample trades",
+	}
+	yesFlag = cli.BoolFlag{
+		Name:  "yes, y",
+		Usage: "Skip confirmation prompt: true, false (default false)",
+	}
 
 	commands = []cli.Command{
+		{
+			Name:      "account",
+			Aliases:   []string{"ac"},
+			Usage:     "Show the account and roles of the API key",
+			UsageText: "gemini-cli account [command options]",
+			Action:    account,
+			Flags: []cli.Flag{
+				jsonFlag,
+			},
+		},
 		{
 			Name:      "active",
 			Aliases:   []string{"a"},
 			Usage:     "List active orders",
 			UsageText: "gemini-cli active [command options]",
-			Action:    active,
-			Flags:     []cli.Flag{jsonFlag},
+			Action:    withExchange(active),
+			Flags: []cli.Flag{
+				csvFlag,
+				descFlag,
+				fieldsFlag,
+				jsonFlag,
+				mktFlag,
+				sideFlag,
+				sortFlag,
+				tableFlag,
+			},
+		},
+		{
+			Name:      "alert",
+			Aliases:   []string{"al"},
+			Usage:     "Wait for the last price to cross a threshold",
+			UsageText: "gemini-cli alert [command options] [mkt]",
+			Action:    withExchange(alert),
+			Flags: []cli.Flag{
+				aboveFlag,
+				belowFlag,
+				intervalFlag,
+				jsonFlag,
+				mktFlag,
+				timeoutFlag,
+			},
+			Before: beforeArgs("mkt"),
+		},
+		{
+			Name:      "arb",
+			Usage:     "Compare ethusd with the price implied by btcusd and ethbtc",
+			UsageText: "gemini-cli arb [command options]",
+			Action:    withExchange(arb),
+			Flags: []cli.Flag{
+				jsonFlag,
+				thresholdFlag,
+			},
+		},
+		{
+			Name:      "auction",
+			Aliases:   []string{"au"},
+			Usage:     "Get current auction",
+			UsageText: "gemini-cli auction [command options] [mkt]",
+			Action:    withExchange(auction),
+			Flags:     []cli.Flag{mktFlag, jsonFlag},
+			Before:    beforeArgs("mkt"),
+		},
+		{
+			Name:      "backtest",
+			Usage:     "Replay a strategy over past candles and report its P&L",
+			UsageText: "gemini-cli backtest [command options] [mkt]",
+			Action:    backtest,
+			Flags: []cli.Flag{
+				backtestFeeFlag,
+				candleIntervalFlag,
+				capitalFlag,
+				jsonFlag,
+				mktFlag,
+				smaCrossFlag,
+			},
+			Before: beforeArgs("mkt"),
 		},
 		{
 			Name:      "balances",
 			Aliases:   []string{"b"},
 			Usage:     "Get fund balances",
 			UsageText: "gemini-cli balances [command options]",
-			Action:    balances,
-			Flags:     []cli.Flag{jsonFlag},
+			Action:    withExchange(balances),
+			Flags:     []cli.Flag{availableOnlyFlag, csvFlag, currencyFlag, fieldsFlag, jsonFlag, nonzeroFlag},
+		},
+		{
+			Name:      "batch",
+			Aliases:   []string{"bt"},
+			Usage:     "Place a list of orders from a file",
+			UsageText: "gemini-cli batch [command options]",
+			Action:    withExchange(batch),
+			Flags: []cli.Flag{
+				bpsFlag,
+				dryRunFlag,
+				fileFlag,
+				makerBpsFlag,
+				mktFlag,
+				takerBpsFlag,
+				yesFlag,
+			},
 		},
 		{
 			Name:      "book",
 			Aliases:   []string{"bk"},
 			Usage:     "Get order book",
-			UsageText: "gemini-cli book [command options]",
-			Action:    book,
-			Flags:     []cli.Flag{mktFlag, limitFlag, jsonFlag},
+			UsageText: "gemini-cli book [command options] [mkt]",
+			Action:    withExchange(book),
+			Flags:     []cli.Flag{mktFlag, limitFlag, bidLimitFlag, askLimitFlag, cumulativeFlag, jsonFlag},
+			Before:    beforeArgs("mkt"),
+		},
+		{
+			Name:      "candles",
+			Aliases:   []string{"cd"},
+			Usage:     "Get OHLC candles",
+			UsageText: "gemini-cli candles [command options] [mkt]",
+			Action:    candles,
+			Flags: []cli.Flag{
+				candleIntervalFlag,
+				csvFlag,
+				jsonFlag,
+				mktFlag,
+			},
+			Before: beforeArgs("mkt"),
 		},
 		{
 			Name:      "cancel",
 			Aliases:   []string{"c"},
-			Usage:     "Cancel active order by txid",
-			UsageText: "gemini-cli cancel [command options]",
-			Action:    cancel,
+			Usage:     "Cancel active orders by txid",
+			UsageText: "gemini-cli cancel [command options] [txid...]",
+			Action:    withExchange(cancel),
 			Flags:     []cli.Flag{txidFlag, jsonFlag},
+			Before:    beforeArgs("txid"),
 		},
 		{
 			Name:      "cancel-all",
 			Aliases:   []string{"ca"},
 			Usage:     "Cancel all active orders",
 			UsageText: "gemini-cli cancel-all [command options]",
-			Action:    cancelAll,
+			Action:    withExchange(cancelAll),
+			Flags:     []cli.Flag{dryRunFlag, jsonFlag, yesFlag},
+		},
+		{
+			Name:      "cancel-by-client-id",
+			Aliases:   []string{"cc"},
+			Usage:     "Cancel live orders by client order id",
+			UsageText: "gemini-cli cancel-by-client-id [command options]",
+			Action:    withExchange(cancelByClientId),
+			Flags:     []cli.Flag{clientOrderIdFlag, jsonFlag},
+		},
+		{
+			Name:      "cancel-matching",
+			Aliases:   []string{"cm"},
+			Usage:     "Cancel active orders matching mkt, side and age",
+			UsageText: "gemini-cli cancel-matching [command options]",
+			Action:    withExchange(cancelMatching),
+			Flags:     []cli.Flag{mktFlag, sideFlag, olderThanFlag, jsonFlag},
+		},
+		{
+			Name:      "completion",
+			Usage:     "Print a shell completion script for bash, zsh or fish",
+			UsageText: "gemini-cli completion <shell>",
+			Action:    completion,
+		},
+		{
+			Name:      "convert",
+			Aliases:   []string{"cv"},
+			Usage:     "Convert between quote and base amounts at the current price",
+			UsageText: "gemini-cli convert [command options] [mkt]",
+			Action:    withExchange(convert),
+			Flags: []cli.Flag{
+				amtFlag,
+				baseAmtFlag,
+				convertFieldFlag,
+				feeBpsFlag,
+				jsonFlag,
+				mktFlag,
+			},
+			Before: beforeArgs("mkt"),
+		},
+		{
+			Name:      "dca",
+			Usage:     "Buy a fixed quote amount on a schedule",
+			UsageText: "gemini-cli dca [command options]",
+			Action:    withExchange(dca),
+			Flags: []cli.Flag{
+				amtFlag,
+				bpsFlag,
+				countFlag,
+				dcaIntervalFlag,
+				dryRunFlag,
+				jsonFlag,
+				makerBpsFlag,
+				metricsAddrFlag,
+				mktFlag,
+				requireHeartbeatFlag,
+				stopOnErrorFlag,
+				takerBpsFlag,
+				typeFlag,
+				webhookFlag,
+				webhookSecretFlag,
+				yesFlag,
+			},
+			Before: beforeMarket,
+		},
+		{
+			Name:      "deposit-address",
+			Aliases:   []string{"da"},
+			Usage:     "Get deposit address for a currency",
+			UsageText: "gemini-cli deposit-address [command options]",
+			Action:    withExchange(depositAddress),
+			Flags: []cli.Flag{
+				currencyFlag,
+				jsonFlag,
+				labelFlag,
+				newFlag,
+			},
+		},
+		{
+			Name:      "estimate",
+			Aliases:   []string{"e"},
+			Usage:     "Estimate fill price and slippage of a market order",
+			UsageText: "gemini-cli estimate [command options]",
+			Action:    withExchange(estimate),
+			Flags: []cli.Flag{
+				amtFlag,
+				baseAmtFlag,
+				jsonFlag,
+				mktFlag,
+				sideFlag,
+			},
+			Before: beforeTransaction,
+		},
+		{
+			Name:      "fees",
+			Aliases:   []string{"f"},
+			Usage:     "Get maker and taker fees for the account",
+			UsageText: "gemini-cli fees [command options]",
+			Action:    fees,
 			Flags:     []cli.Flag{jsonFlag},
 		},
+		{
+			Name:      "heartbeat",
+			Aliases:   []string{"hb"},
+			Usage:     "Send a heartbeat to keep a session that requires them alive",
+			UsageText: "gemini-cli heartbeat [command options]",
+			Action:    heartbeat,
+			Flags: []cli.Flag{
+				intervalFlag,
+				jsonFlag,
+				watchFlag,
+			},
+		},
+		{
+			Name:      "ladder",
+			Aliases:   []string{"ld"},
+			Usage:     "Place limit orders spread across a price range",
+			UsageText: "gemini-cli ladder [command options]",
+			Action:    withExchange(ladder),
+			Flags: []cli.Flag{
+				baseAmtFlag,
+				bpsFlag,
+				dryRunFlag,
+				fromPriceFlag,
+				geometricFlag,
+				jsonFlag,
+				makerBpsFlag,
+				mktFlag,
+				ordersFlag,
+				sideFlag,
+				toPriceFlag,
+				yesFlag,
+			},
+			Before: beforeTransaction,
+		},
 		{
 			Name:      "limit",
 			Aliases:   []string{"l"},
 			Usage:     "Create a limit order",
 			UsageText: "gemini-cli limit [command options]",
-			Action:    limit,
+			Action:    withExchange(limit),
 			Flags: []cli.Flag{
 				amtFlag,
 				baseAmtFlag,
 				bpsFlag,
+				clientOrderIdFlag,
+				forceFlag,
+				intervalFlag,
 				jsonFlag,
+				makerBpsFlag,
+				maxDeviationFlag,
 				mktFlag,
+				pctFlag,
 				priceFlag,
 				sideFlag,
+				stdinFlag,
+				strictFlag,
+				limitTifFlag,
+				timeoutFlag,
+				waitFlag,
+				webhookFlag,
+				webhookSecretFlag,
+				yesFlag,
 			},
 			Before: beforeTransaction,
 		},
@@ -131,46 +832,336 @@ var (
 			Aliases:   []string{"m"},
 			Usage:     "Create a market order",
 			UsageText: "gemini-cli market [command options]",
-			Action:    market,
+			Action:    withExchange(market),
 			Flags: []cli.Flag{
 				amtFlag,
 				baseAmtFlag,
 				bpsFlag,
+				clientOrderIdFlag,
+				forceFlag,
 				jsonFlag,
+				maxDeviationFlag,
+				maxRequotesFlag,
 				mktFlag,
+				noRetryFlag,
+				pctFlag,
 				sideFlag,
+				stdinFlag,
+				takerBpsFlag,
+				marketTifFlag,
 				unsafeFlag,
+				webhookFlag,
+				webhookSecretFlag,
+				yesFlag,
 			},
 			Before: beforeTransaction,
 		},
+		{
+			Name:      "mid",
+			Aliases:   []string{"md"},
+			Usage:     "Print the mid, bid, ask or last price as a bare number",
+			UsageText: "gemini-cli mid [command options] [mkt]",
+			Action:    withExchange(mid),
+			Flags:     []cli.Flag{mktFlag, fieldFlag},
+			Before:    beforeArgs("mkt"),
+		},
+		{
+			Name:    "mm",
+			Aliases: []string{"mk"},
+			Usage:   "Make a market, keeping a bid and an ask around the mid",
+			Description: "mm runs in the foreground, checking its quotes every interval. Filled " +
+				"quotes are placed again; both are replaced once the mid moves past reprice-bps. " +
+				"Ctrl-C cancels both quotes and prints what was traded.",
+			UsageText: "gemini-cli mm [command options] [mkt]",
+			Action:    withExchange(mm),
+			Flags: []cli.Flag{
+				baseAmtFlag,
+				intervalFlag,
+				jsonFlag,
+				maxPositionFlag,
+				metricsAddrFlag,
+				mktFlag,
+				repriceBpsFlag,
+				requireHeartbeatFlag,
+				spreadBpsFlag,
+				yesFlag,
+			},
+			Before: chainBefore(beforeArgs("mkt"), beforeMarket),
+		},
+		{
+			Name:    "oco",
+			Aliases: []string{"oc"},
+			Usage:   "Bracket a position with a take-profit and a stop-limit, cancelling one when the other fills",
+			Description: "Both orders are placed on the exchange, and each holds the full amount. " +
+				"oco keeps running to manage the pair: it polls both every interval and " +
+				"cancels the other as soon as one fills or is cancelled. If it's stopped " +
+				"both orders are left live.",
+			UsageText: "gemini-cli oco [command options] [mkt]",
+			Action:    withExchange(oco),
+			Flags: []cli.Flag{
+				baseAmtFlag,
+				intervalFlag,
+				jsonFlag,
+				mktFlag,
+				closeSideFlag,
+				stopFlag,
+				stopLimitFlag,
+				strictFlag,
+				takeProfitFlag,
+				yesFlag,
+			},
+			Before: chainBefore(beforeArgs("mkt"), beforeMarket),
+		},
+		{
+			Name:      "pnl",
+			Aliases:   []string{"p"},
+			Usage:     "Realized P&L from trade history using FIFO cost basis",
+			UsageText: "gemini-cli pnl [command options] [mkt]",
+			Action:    withExchange(pnl),
+			Flags:     []cli.Flag{mktFlag, jsonFlag},
+			Before:    beforeArgs("mkt"),
+		},
+		{
+			Name:      "portfolio",
+			Aliases:   []string{"pf"},
+			Usage:     "Value of all balances in a quote currency",
+			UsageText: "gemini-cli portfolio [command options]",
+			Action:    withExchange(portfolio),
+			Flags:     []cli.Flag{quoteFlag, jsonFlag},
+		},
+		{
+			Name:      "repl",
+			Aliases:   []string{"shell"},
+			Usage:     "Run commands interactively, reusing one session",
+			UsageText: "gemini-cli [global options] repl",
+			Action:    repl,
+		},
+		{
+			Name:      "replace",
+			Aliases:   []string{"rp"},
+			Usage:     "Move a live order to a new price or amount",
+			UsageText: "gemini-cli replace [command options] [txid]",
+			Action:    withExchange(replace),
+			Flags: []cli.Flag{
+				amtFlag,
+				baseAmtFlag,
+				bpsFlag,
+				clientOrderIdFlag,
+				forceFlag,
+				jsonFlag,
+				makerBpsFlag,
+				maxDeviationFlag,
+				priceFlag,
+				strictFlag,
+				txidFlag,
+				yesFlag,
+			},
+			Before: beforeArgs("txid"),
+		},
+		{
+			Name:      "spread",
+			Aliases:   []string{"sp"},
+			Usage:     "Get the bid/ask spread",
+			UsageText: "gemini-cli spread [command options] [mkt]",
+			Action:    withExchange(spread),
+			Flags:     []cli.Flag{mktFlag, jsonFlag},
+			Before:    beforeArgs("mkt"),
+		},
+		{
+			Name:      "stats",
+			Aliases:   []string{"st"},
+			Usage:     "Summarize the market's recent trades",
+			UsageText: "gemini-cli stats [command options] [mkt]",
+			Action:    stats,
+			Flags: []cli.Flag{
+				jsonFlag,
+				mktFlag,
+				windowFlag,
+			},
+			Before: beforeArgs("mkt"),
+		},
 		{
 			Name:      "status",
 			Aliases:   []string{"s"},
-			Usage:     "Get status of active order",
-			UsageText: "gemini-cli status [command options]",
-			Action:    status,
-			Flags:     []cli.Flag{txidFlag, jsonFlag},
+			Usage:     "Get status of orders by txid",
+			UsageText: "gemini-cli status [command options] [txid...]",
+			Action:    withExchange(status),
+			Flags:     []cli.Flag{txidFlag, jsonFlag, waitFlag, intervalFlag, timeoutFlag},
+			Before:    beforeArgs("txid"),
+		},
+		{
+			Name:      "status-by-client-id",
+			Aliases:   []string{"sc"},
+			Usage:     "Get status of orders by client order id",
+			UsageText: "gemini-cli status-by-client-id [command options]",
+			Action:    statusByClientId,
+			Flags:     []cli.Flag{clientOrderIdFlag, jsonFlag},
+		},
+		{
+			Name:      "stream-book",
+			Aliases:   []string{"sb"},
+			Usage:     "Stream order book updates",
+			UsageText: "gemini-cli stream-book [command options] [mkt]",
+			Action:    streamOrderBook,
+			Flags:     []cli.Flag{mktFlag, limitFlag, jsonFlag},
+			Before:    beforeArgs("mkt"),
+		},
+		{
+			Name:      "stream-orders",
+			Aliases:   []string{"so"},
+			Usage:     "Stream events for the account's orders",
+			UsageText: "gemini-cli stream-orders [command options]",
+			Action:    streamOrders,
+			Flags:     []cli.Flag{mktFlag, jsonFlag, metricsAddrFlag, requireHeartbeatFlag, webhookFlag, webhookSecretFlag},
+		},
+		{
+			Name:      "symbols",
+			Aliases:   []string{"sy"},
+			Usage:     "List tradable markets",
+			UsageText: "gemini-cli symbols [command options]",
+			Action:    withExchange(symbolsList),
+			Flags:     []cli.Flag{jsonFlag, refreshFlag},
 		},
 		{
 			Name:      "ticker",
 			Aliases:   []string{"tr"},
 			Usage:     "Get ticker",
-			UsageText: "gemini-cli ticker [command options]",
-			Action:    ticker,
-			Flags:     []cli.Flag{mktFlag, jsonFlag},
+			UsageText: "gemini-cli ticker [command options] [mkt...]",
+			Action:    withExchange(ticker),
+			Flags:     []cli.Flag{mktFlag, jsonFlag, watchFlag, intervalFlag},
+			Before:    beforeArgs("mkt"),
+		},
+		{
+			Name:      "top",
+			Aliases:   []string{"tp"},
+			Usage:     "One line summary of the top of the book",
+			UsageText: "gemini-cli top [command options] [mkt]",
+			Action:    withExchange(top),
+			Flags:     []cli.Flag{mktFlag, jsonFlag, watchFlag, intervalFlag},
+			Before:    beforeArgs("mkt"),
 		},
 		{
 			Name:      "trades",
 			Aliases:   []string{"t"},
 			Usage:     "List past trades",
-			UsageText: "gemini-cli trades [command options]",
-			Action:    trades,
+			UsageText: "gemini-cli trades [command options] [mkt]",
+			Action:    withExchange(trades),
 			Flags: []cli.Flag{
+				allFlag,
+				csvFlag,
 				dateFlag,
+				fieldsFlag,
+				fromFlag,
 				jsonFlag,
 				limitFlag,
 				mktFlag,
+				summaryOnlyFlag,
+				tableFlag,
 				timeFlag,
+				toFlag,
+				tzFlag,
+			},
+			Before: beforeArgs("mkt"),
+		},
+		{
+			Name:    "trailing-stop",
+			Aliases: []string{"ts"},
+			Usage:   "Sell once the price falls back by a trail from its best, or buy once it rises by one",
+			Description: "The stop is managed here rather than on the exchange, so trailing-stop " +
+				"has to keep running: it polls the ticker every interval, moves the trigger " +
+				"with the best price and fills a market order when the price crosses it.",
+			UsageText: "gemini-cli trailing-stop [command options] [mkt]",
+			Action:    withExchange(trailingStop),
+			Flags: []cli.Flag{
+				baseAmtFlag,
+				clientOrderIdFlag,
+				closeSideFlag,
+				intervalFlag,
+				jsonFlag,
+				maxRequotesFlag,
+				mktFlag,
+				noRetryFlag,
+				trailFlag,
+				unsafeFlag,
+				yesFlag,
+			},
+			Before: chainBefore(beforeArgs("mkt"), beforeMarket),
+		},
+		{
+			Name:      "transfers",
+			Aliases:   []string{"tf"},
+			Usage:     "List deposits and withdrawals",
+			UsageText: "gemini-cli transfers [command options] [currency]",
+			Action:    transfers,
+			Flags: []cli.Flag{
+				allFlag,
+				csvFlag,
+				currencyFlag,
+				fieldsFlag,
+				jsonFlag,
+				limitFlag,
+				tableFlag,
+				timeFlag,
+			},
+			Before: beforeArgs("currency"),
+		},
+		{
+			Name:      "twap",
+			Aliases:   []string{"tw"},
+			Usage:     "Work a market order in slices over time",
+			UsageText: "gemini-cli twap [command options]",
+			Action:    withExchange(twap),
+			Flags: []cli.Flag{
+				amtFlag,
+				baseAmtFlag,
+				bpsFlag,
+				clientOrderIdFlag,
+				durationFlag,
+				jsonFlag,
+				maxSlippageFlag,
+				metricsAddrFlag,
+				mktFlag,
+				requireHeartbeatFlag,
+				sideFlag,
+				slicesFlag,
+				takerBpsFlag,
+				yesFlag,
+			},
+			Before: beforeTransaction,
+		},
+		{
+			Name:      "version",
+			Usage:     "Print the version, commit and build date of this build",
+			UsageText: "gemini-cli version [command options]",
+			Action:    version,
+			Flags:     []cli.Flag{jsonFlag},
+		},
+		{
+			Name:      "vwap",
+			Aliases:   []string{"vw"},
+			Usage:     "Volume-weighted average price to fill a base amount from the book",
+			UsageText: "gemini-cli vwap [command options]",
+			Action:    withExchange(vwap),
+			Flags: []cli.Flag{
+				baseAmtFlag,
+				jsonFlag,
+				mktFlag,
+				sideFlag,
+			},
+			Before: beforeTransaction,
+		},
+		{
+			Name:      "withdraw",
+			Aliases:   []string{"w"},
+			Usage:     "Withdraw crypto to an address",
+			UsageText: "gemini-cli withdraw [command options]",
+			Action:    withExchange(withdraw),
+			Flags: []cli.Flag{
+				addressFlag,
+				amtFlag,
+				currencyFlag,
+				jsonFlag,
+				yesFlag,
 			},
 		},
 	}
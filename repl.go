@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// runRepl reads commands from stdin and runs each through app until EOF or
+// exit. The client, config and symbol caches set up for the repl itself are
+// reused, so app.Before is dropped and global flags on a line are ignored.
+func runRepl(app *cli.App) error {
+	app.Before = nil
+
+	history := loadHistory()
+	interactive := isTerminal(os.Stdin)
+
+	for {
+		resetInterrupt()
+
+		if interactive {
+			fmt.Fprint(os.Stderr, replPrompt())
+		}
+
+		line, readErr := readLine()
+		if readErr != nil && readErr != io.EOF {
+			if isInterrupted(readErr) {
+				fmt.Fprintln(os.Stderr, "")
+				continue
+			}
+			return readErr
+		}
+
+		line = strings.TrimSpace(line)
+		if readErr == io.EOF && line == "" {
+			if interactive {
+				fmt.Fprintln(os.Stderr, "")
+			}
+			return nil
+		}
+
+		line, err := expandHistory(line, history)
+		if err != nil {
+			printError(err)
+			continue
+		}
+
+		switch line {
+		case "":
+			continue
+		case "exit", "quit":
+			return nil
+		case "history":
+			for i, h := range history {
+				fmt.Fprintf(stdout, "%5d  %s\n", i+1, h)
+			}
+			continue
+		}
+
+		words, err := splitWords(line)
+		if err != nil {
+			printError(err)
+			continue
+		}
+
+		history = append(history, line)
+		appendHistory(line)
+
+		if cmd := app.Command(words[0]); cmd != nil && cmd.Name == "repl" {
+			printError(errors.New(ERROR_NESTED_REPL))
+			continue
+		}
+
+		// errors have already been printed by the command
+		app.Run(append([]string{app.Name}, words...))
+
+		if readErr == io.EOF {
+			return nil
+		}
+	}
+}
+
+// expandHistory replaces a line of !! with the previous command and !n with
+// the nth command listed by history.
+func expandHistory(line string, history []string) (string, error) {
+	if !strings.HasPrefix(line, "!") {
+		return line, nil
+	}
+
+	n := len(history)
+	if line != "!!" {
+		i, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return line, nil
+		}
+		n = i
+	}
+
+	if n < 1 || n > len(history) {
+		return "", fmt.Errorf("%s: %s", ERROR_HISTORY_EVENT, line)
+	}
+
+	expanded := history[n-1]
+	fmt.Fprintln(os.Stderr, expanded)
+
+	return expanded, nil
+}
+
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, HISTORY_FILE_NAME)
+}
+
+// loadHistory reads the last HISTORY_SIZE lines of the history file. History
+// is a convenience, so a missing or unreadable file is an empty history.
+func loadHistory() []string {
+	path := historyPath()
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var history []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			history = append(history, line)
+		}
+	}
+
+	if len(history) > HISTORY_SIZE {
+		history = history[len(history)-HISTORY_SIZE:]
+	}
+
+	return history
+}
+
+func appendHistory(line string) {
+	path := historyPath()
+	if path == "" {
+		return
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	fmt.Fprintln(f, line)
+}
+
+func replPrompt() string {
+	if paperTrading {
+		return blue("gemini (paper)") + "> "
+	}
+	if gemini_api_live {
+		return red("gemini (live)") + "> "
+	}
+	return blue("gemini") + "> "
+}
+
+// splitWords splits line on whitespace the way a shell would for simple
+// cases: single and double quotes group words and are removed.
+func splitWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+
+	inWord := false
+	var quote rune
+
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New(ERROR_OPEN_QUOTE)
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
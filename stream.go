@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jsgoyette/gemini"
+)
+
+type marketDataEvent struct {
+	Type      string  `json:"type"`
+	Reason    string  `json:"reason"`
+	Side      string  `json:"side"`
+	Price     float64 `json:"price,string"`
+	Delta     float64 `json:"delta,string"`
+	Remaining float64 `json:"remaining,string"`
+}
+
+type marketDataMessage struct {
+	Type           string            `json:"type"`
+	EventId        int64             `json:"eventId"`
+	TimestampMS    int64             `json:"timestampms"`
+	SocketSequence int64             `json:"socket_sequence"`
+	Events         []marketDataEvent `json:"events"`
+}
+
+type orderEvent struct {
+	Type              string     `json:"type"`
+	OrderId           string     `json:"order_id"`
+	ClientOrderId     string     `json:"client_order_id"`
+	Symbol            string     `json:"symbol"`
+	Side              string     `json:"side"`
+	OrderType         string     `json:"order_type"`
+	Reason            string     `json:"reason"`
+	TimestampMS       int64      `json:"timestampms"`
+	IsLive            bool       `json:"is_live"`
+	IsCancelled       bool       `json:"is_cancelled"`
+	Price             float64    `json:"price,string"`
+	OriginalAmount    float64    `json:"original_amount,string"`
+	ExecutedAmount    float64    `json:"executed_amount,string"`
+	RemainingAmount   float64    `json:"remaining_amount,string"`
+	AvgExecutionPrice float64    `json:"avg_execution_price,string"`
+	Fill              *orderFill `json:"fill,omitempty"`
+}
+
+// orderFill is the trade that a fill event reports.
+type orderFill struct {
+	TradeId     string  `json:"trade_id"`
+	Liquidity   string  `json:"liquidity"`
+	Price       float64 `json:"price,string"`
+	Amount      float64 `json:"amount,string"`
+	Fee         float64 `json:"fee,string"`
+	FeeCurrency string  `json:"fee_currency"`
+}
+
+func (e orderEvent) order() gemini.Order {
+	return gemini.Order{
+		OrderId:           e.OrderId,
+		ClientOrderId:     e.ClientOrderId,
+		Symbol:            e.Symbol,
+		Side:              e.Side,
+		Type:              e.OrderType,
+		Price:             e.Price,
+		OriginalAmount:    e.OriginalAmount,
+		ExecutedAmount:    e.ExecutedAmount,
+		RemainingAmount:   e.RemainingAmount,
+		AvgExecutionPrice: e.AvgExecutionPrice,
+		IsLive:            e.IsLive,
+		IsCancelled:       e.IsCancelled,
+	}
+}
+
+// streamBook keeps a local copy of one market's order book from the
+// market data websocket.
+type streamBook struct {
+	bids map[float64]float64
+	asks map[float64]float64
+}
+
+func newStreamBook() *streamBook {
+	return &streamBook{
+		bids: map[float64]float64{},
+		asks: map[float64]float64{},
+	}
+}
+
+func (b *streamBook) apply(msg marketDataMessage) {
+	for _, event := range msg.Events {
+		if event.Type != "change" {
+			continue
+		}
+
+		levels := b.asks
+		if event.Side == "bid" {
+			levels = b.bids
+		}
+
+		if event.Remaining == 0 {
+			delete(levels, event.Price)
+		} else {
+			levels[event.Price] = event.Remaining
+		}
+	}
+}
+
+// top returns up to lim levels on each side, best price first.
+func (b *streamBook) top(lim int) gemini.Book {
+	return gemini.Book{
+		Bids: topLevels(b.bids, lim, true),
+		Asks: topLevels(b.asks, lim, false),
+	}
+}
+
+func getStreamUrl(path string) string {
+	streamUrl := strings.Replace(gemini_api_url, "https://", "wss://", 1)
+	return strings.Replace(streamUrl, "http://", "ws://", 1) + path
+}
+
+func isAuthFailure(resp *http.Response) bool {
+	return resp != nil && (resp.StatusCode == http.StatusUnauthorized ||
+		resp.StatusCode == http.StatusForbidden ||
+		resp.StatusCode == http.StatusBadRequest)
+}
+
+// readStream passes each message from conn to handle until the connection
+// drops, handle fails, or an interrupt arrives. Errors from handle are
+// fatal while read errors mean the connection should be redialed.
+func readStream(conn *websocket.Conn, interrupt <-chan os.Signal, handle func([]byte) error) (bool, error) {
+	msgs := make(chan []byte)
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			select {
+			case msgs <- msg:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-interrupt:
+			conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return true, nil
+		case err := <-errs:
+			return false, err
+		case msg := <-msgs:
+			err := handle(msg)
+			if err != nil {
+				return true, err
+			}
+		}
+	}
+}
+
+// stream dials url and hands every message to handle until interrupted.
+// Dropped connections are redialed with exponential backoff, building a
+// fresh header for each dial and calling connect once connected so callers
+// can reset their state.
+func stream(url string, header func() (http.Header, error), connect func(), handle func([]byte) error) error {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	delay := RETRY_BASE_DELAY
+
+	for {
+		h, err := header()
+		if err != nil {
+			return err
+		}
+
+		conn, resp, err := websocket.DefaultDialer.Dial(url, h)
+		if isAuthFailure(resp) {
+			return errors.New(ERROR_STREAM_AUTH)
+		}
+
+		if err == nil {
+			delay = RETRY_BASE_DELAY
+			connect()
+
+			var fatal bool
+			fatal, err = readStream(conn, interrupt, handle)
+			conn.Close()
+
+			if fatal {
+				return err
+			}
+		}
+
+		slog.Debug("Disconnected, reconnecting", "error", err, "delay", delay)
+
+		select {
+		case <-interrupt:
+			return nil
+		case <-time.After(delay):
+		}
+
+		if delay < STREAM_MAX_DELAY {
+			delay *= 2
+		}
+	}
+}
+
+func topLevels(levels map[float64]float64, lim int, desc bool) []gemini.BookEntry {
+	entries := make([]gemini.BookEntry, 0, len(levels))
+	for price, amount := range levels {
+		entries = append(entries, gemini.BookEntry{Price: price, Amount: amount})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if desc {
+			return entries[i].Price > entries[j].Price
+		}
+		return entries[i].Price < entries[j].Price
+	})
+
+	if len(entries) > lim {
+		entries = entries[:lim]
+	}
+
+	return entries
+}
@@ -1,82 +1,2804 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
 	"time"
 
+	"github.com/fatih/color"
 	"github.com/jsgoyette/gemini"
+	"github.com/mattn/go-isatty"
+	"github.com/urfave/cli"
 )
 
+// accountInfo is the account an API key belongs to, along with the roles
+// granted to the key.
+type accountInfo struct {
+	Name      string   `json:"name"`
+	ShortName string   `json:"short_name"`
+	Type      string   `json:"type"`
+	CreatedMS int64    `json:"created_ms"`
+	Roles     []string `json:"roles"`
+	Live      bool     `json:"live"`
+}
+
+type alertResult struct {
+	Market    string  `json:"market"`
+	Price     float64 `json:"price"`
+	Condition string  `json:"condition"`
+	Threshold float64 `json:"threshold"`
+}
+
+// arbCheck compares ethusd with the price implied by going through btc,
+// btcusd * ethbtc, using the mid of each market.
+type arbCheck struct {
+	BtcUsd    float64 `json:"btcusd"`
+	EthBtc    float64 `json:"ethbtc"`
+	EthUsd    float64 `json:"ethusd"`
+	Implied   float64 `json:"implied_ethusd"`
+	GapPct    float64 `json:"gap_pct"`
+	Threshold float64 `json:"threshold"`
+	Flagged   bool    `json:"flagged"`
+}
+
+// bookFill is the result of walking the book to fill an amount.
+type bookFill struct {
+	BaseAmount  float64 `json:"base_amount"`
+	QuoteAmount float64 `json:"quote_amount"`
+	AvgPrice    float64 `json:"avg_price"`
+	BestPrice   float64 `json:"best_price"`
+	WorstPrice  float64 `json:"worst_price"`
+	SlippageBps float64 `json:"slippage_bps"`
+	Levels      int     `json:"levels"`
+	Shortfall   float64 `json:"shortfall"`
+}
+
+// cancelSummary is the result of cancelling a subset of active orders,
+// including the ones that were left alone.
+type cancelSummary struct {
+	gemini.CancelResult
+	Skipped []string `json:"skipped"`
+}
+
+type candle struct {
+	Timestamp int64   `json:"timestamp"`
+	Open      float64 `json:"open"`
+	High      float64 `json:"high"`
+	Low       float64 `json:"low"`
+	Close     float64 `json:"close"`
+	Volume    float64 `json:"volume"`
+}
+
+// conversion is an amount of quote currency and its equivalent in base
+// currency at the current price.
+type conversion struct {
+	Market      string  `json:"market"`
+	Price       float64 `json:"price"`
+	BaseAmount  float64 `json:"base_amount"`
+	QuoteAmount float64 `json:"quote_amount"`
+	FeeBps      int     `json:"fee_bps"`
+	Fee         float64 `json:"fee"`
+}
+
+// dcaRound is the outcome of one scheduled buy.
+type dcaRound struct {
+	Round     int           `json:"round"`
+	Timestamp int64         `json:"timestamp"`
+	Price     float64       `json:"price,omitempty"`
+	Order     *gemini.Order `json:"order,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+type depositAddressResult struct {
+	Currency string `json:"currency"`
+	Address  string `json:"address"`
+	Label    string `json:"label"`
+}
+
+type fillSummary struct {
+	Orders      int     `json:"orders"`
+	BaseAmount  float64 `json:"base_amount"`
+	QuoteAmount float64 `json:"quote_amount"`
+	AvgPrice    float64 `json:"avg_price"`
+}
+
+type heartbeatResult struct {
+	Result    string `json:"result"`
+	Timestamp int64  `json:"timestampms"`
+}
+
+// marketTrade is a trade on the exchange's public trade history.
+type marketTrade struct {
+	TimestampMS int64   `json:"timestampms"`
+	Tid         int64   `json:"tid"`
+	Price       float64 `json:"price,string"`
+	Amount      float64 `json:"amount,string"`
+	Type        string  `json:"type"`
+}
+
+// marketTicker is the ticker of one of several markets fetched together,
+// or the error fetching it.
+type marketTicker struct {
+	Market string  `json:"market"`
+	Bid    float64 `json:"bid"`
+	Ask    float64 `json:"ask"`
+	Last   float64 `json:"last"`
+	Error  string  `json:"error,omitempty"`
+}
+
+type notionalVolume struct {
+	Date              string  `json:"date"`
+	LastUpdatedMS     int64   `json:"last_updated_ms"`
+	MakerFeeBps       int     `json:"api_maker_fee_bps"`
+	TakerFeeBps       int     `json:"api_taker_fee_bps"`
+	AuctionFeeBps     int     `json:"api_auction_fee_bps"`
+	Notional30dVolume float64 `json:"notional_30d_volume"`
+}
+
+// sideVolume is what the account traded on one side: the base amount and
+// what it came to in the quote currency.
+type sideVolume struct {
+	Trades   int     `json:"trades"`
+	Amount   float64 `json:"amount"`
+	Notional float64 `json:"notional"`
+}
+
+type stdinLine struct {
+	text string
+	err  error
+}
+
+type symbolDetails struct {
+	Symbol         string  `json:"symbol"`
+	BaseCurrency   string  `json:"base_currency"`
+	QuoteCurrency  string  `json:"quote_currency"`
+	TickSize       float64 `json:"tick_size"`
+	QuoteIncrement float64 `json:"quote_increment"`
+	MinOrderSize   float64 `json:"min_order_size,string"`
+	Status         string  `json:"status"`
+}
+
+// tradeStats summarizes the market's trades since From. Buy and sell
+// volume are split by the taker's side.
+type tradeStats struct {
+	Market     string  `json:"market"`
+	From       int64   `json:"from"`
+	Count      int     `json:"count"`
+	MinPrice   float64 `json:"min_price"`
+	MaxPrice   float64 `json:"max_price"`
+	AvgPrice   float64 `json:"avg_price"`
+	Vwap       float64 `json:"vwap"`
+	Volume     float64 `json:"volume"`
+	BuyVolume  float64 `json:"buy_volume"`
+	SellVolume float64 `json:"sell_volume"`
+}
+
+// tradeSummary totals a list of the account's trades, with fees keyed by
+// fee currency and volume by side.
+type tradeSummary struct {
+	Trades int                   `json:"trades"`
+	Fees   map[string]float64    `json:"fees"`
+	Volume map[string]sideVolume `json:"volume"`
+}
+
+type topOfBook struct {
+	Bid       float64 `json:"bid"`
+	Ask       float64 `json:"ask"`
+	Spread    float64 `json:"spread"`
+	Mid       float64 `json:"mid"`
+	SpreadBps float64 `json:"spread_bps"`
+}
+
+// topQuote is the top of the book along with the last trade price.
+type topQuote struct {
+	topOfBook
+	Last float64 `json:"last"`
+}
+
+// trailReport is how a trailing stop played out: the best price it saw,
+// the trigger it trailed that price with and the price that crossed it.
+type trailReport struct {
+	fillSummary
+	Market  string         `json:"market"`
+	Side    string         `json:"side"`
+	Peak    float64        `json:"peak"`
+	Trigger float64        `json:"trigger"`
+	Price   float64        `json:"price"`
+	Orders  []gemini.Order `json:"orders"`
+}
+
+// transfer is a deposit or withdrawal as listed by the transfers endpoint.
+type transfer struct {
+	Type        string  `json:"type"`
+	Status      string  `json:"status"`
+	TimestampMS int64   `json:"timestampms"`
+	Eid         int64   `json:"eid"`
+	Currency    string  `json:"currency"`
+	Amount      float64 `json:"amount,string"`
+	Method      string  `json:"method,omitempty"`
+	TxHash      string  `json:"txHash,omitempty"`
+	Destination string  `json:"destination,omitempty"`
+}
+
+// vwapResult is the volume-weighted average price of filling a base
+// amount against the book, and how much of the book that takes.
+type vwapResult struct {
+	Vwap        float64 `json:"vwap"`
+	BaseAmount  float64 `json:"base_amount"`
+	QuoteAmount float64 `json:"quote_amount"`
+	Levels      int     `json:"levels"`
+	BookDepth   float64 `json:"book_depth"`
+	Shortfall   float64 `json:"shortfall"`
+}
+
+// twapReport totals the slices of a twap order. Remaining is in the
+// currency the order was sized in.
+type twapReport struct {
+	fillSummary
+	Slices    int            `json:"slices"`
+	Skipped   int            `json:"skipped"`
+	Remaining float64        `json:"remaining"`
+	Orders    []gemini.Order `json:"orders"`
+}
+
+// alignColumns lays out rows as tab-aligned lines. Widths are computed on
+// the plain text across all rows so that color can be applied afterwards
+// without escape codes skewing the columns.
+func alignColumns(rows [][]string) []string {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func candleTable(candles []candle) ([]string, [][]string) {
+	header := []string{
+		"Timestamp",
+		"Open",
+		"High",
+		"Low",
+		"Close",
+		"Volume",
+	}
+
+	rows := make([][]string, 0, len(candles))
+	for _, candle := range candles {
+		rows = append(rows, []string{
+			formatTimestamp(candle.Timestamp, time.Millisecond),
+			fmt.Sprintf("%.*f", precision, candle.Open),
+			fmt.Sprintf("%.*f", precision, candle.High),
+			fmt.Sprintf("%.*f", precision, candle.Low),
+			fmt.Sprintf("%.*f", precision, candle.Close),
+			fmt.Sprintf("%.*f", precision, candle.Volume),
+		})
+	}
+
+	return header, rows
+}
+
+func balanceTable(balances []gemini.FundBalance) ([]string, [][]string) {
+	header := []string{"Currency", "Amount", "Available", "AvailableForWithdrawal"}
+
+	rows := make([][]string, 0, len(balances))
+	for _, fund := range balances {
+		rows = append(rows, []string{
+			fund.Currency,
+			fmt.Sprintf("%.*f", precision, fund.Amount),
+			fmt.Sprintf("%.*f", precision, fund.Available),
+			fmt.Sprintf("%.*f", precision, fund.AvailableForWithdrawal),
+		})
+	}
+
+	return header, rows
+}
+
+// bookRows formats one side of the book, best price first.
+func bookRows(entries []gemini.BookEntry, cumulative bool) [][]string {
+	rows := make([][]string, 0, len(entries))
+
+	totalAmount, totalNotional := 0.0, 0.0
+
+	for _, entry := range entries {
+		row := []string{
+			fmt.Sprintf("%.*f", precision, entry.Price),
+			fmt.Sprintf("%.*f", precision, entry.Amount),
+		}
+
+		if cumulative {
+			totalAmount += entry.Amount
+			totalNotional += entry.Amount * entry.Price
+
+			row = append(row,
+				fmt.Sprintf("%.*f", precision, totalAmount),
+				fmt.Sprintf("%.*f", precision, totalNotional),
+			)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// cancelOrders cancels each order in turn, collecting the results in the
+// same shape as cancelling everything at once.
+func cancelOrders(ex exchange, orders []gemini.Order) gemini.CancelResult {
+	res := gemini.CancelResult{Result: "ok"}
+	res.Details.CancelledOrders = []string{}
+	res.Details.CancelRejects = []string{}
+
+	for _, order := range orders {
+		_, err := ex.CancelOrder(order.OrderId)
+		if err != nil {
+			res.Details.CancelRejects = append(res.Details.CancelRejects, order.OrderId)
+			continue
+		}
+		res.Details.CancelledOrders = append(res.Details.CancelledOrders, order.OrderId)
+	}
+
+	return res
+}
+
+// checkBookAge fails when the newest of the best bid and ask is older than
+// --max-book-age. The gemini package drops the levels' timestamps, so the
+// top of the book is requested again directly. A quiet market can leave
+// its best levels untouched for a while, hence the lenient default.
+func checkBookAge(mkt string) error {
+	if maxBookAge <= 0 {
+		return nil
+	}
+
+	type level struct {
+		Timestamp int64 `json:"timestamp,string"`
+	}
+
+	var book struct {
+		Bids []level `json:"bids"`
+		Asks []level `json:"asks"`
+	}
+	err := withRetry(func() error {
+		return publicRequest("/v1/book/"+mkt+"?limit_bids=1&limit_asks=1", &book)
+	})
+	if err != nil {
+		return err
+	}
+
+	var newest int64
+	for _, l := range append(book.Bids, book.Asks...) {
+		if l.Timestamp > newest {
+			newest = l.Timestamp
+		}
+	}
+
+	// nothing to go by
+	if newest == 0 {
+		return nil
+	}
+
+	age := time.Since(time.Unix(newest, 0))
+	if age > maxBookAge {
+		return fmt.Errorf("%s: last updated %v ago", ERROR_STALE_BOOK, age.Round(time.Second))
+	}
+
+	return nil
+}
+
+// checkDeviation rejects an order on mkt whose price is more than maxPct
+// percent from the mid. A price of 0 is a market order, checked at the
+// best price on the side it would take. A maxPct of 0 turns the check off.
+func checkDeviation(ex exchange, mkt, side string, price, maxPct float64) error {
+	if maxPct <= 0 {
+		return nil
+	}
+
+	top, err := getTopOfBook(ex, mkt)
+	if err != nil {
+		return err
+	}
+
+	if price == 0 {
+		price = top.Ask
+		if side == "sell" {
+			price = top.Bid
+		}
+	}
+
+	deviation := math.Abs(price-top.Mid) / top.Mid * 100
+	if deviation > maxPct {
+		return fmt.Errorf("%s: %v is %.2f%% from the mid of %v, pass --force to place it anyway", ERROR_MAX_DEVIATION, price, deviation, top.Mid)
+	}
+
+	return nil
+}
+
+// clearLines moves the cursor up n lines and clears to the end of the
+// screen so the next print redraws in place.
+func clearLines(n int) {
+	terminalControl(fmt.Sprintf("\033[%dA\033[J", n))
+}
+
+// colorizeJSON highlights the object keys of indented JSON. It's a no-op
+// when color is disabled.
+func colorizeJSON(data []byte) string {
+	if color.NoColor {
+		return string(data)
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(data); i++ {
+		if data[i] != '"' {
+			b.WriteByte(data[i])
+			continue
+		}
+
+		// find the closing quote, skipping escaped characters
+		j := i + 1
+		for j < len(data) && data[j] != '"' {
+			if data[j] == '\\' {
+				j++
+			}
+			j++
+		}
+
+		str := string(data[i : j+1])
+
+		if j+1 < len(data) && data[j+1] == ':' {
+			b.WriteString(blue(str))
+		} else {
+			b.WriteString(str)
+		}
+
+		i = j
+	}
+
+	return b.String()
+}
+
+// confirm asks a yes/no question on the terminal and returns an error
+// unless the answer is yes. It refuses to ask when stdin isn't a tty.
+func confirm(prompt string) error {
+	if !isTerminal(os.Stdin) {
+		return errors.New(ERROR_NOT_TTY)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", prompt)
+
+	answer, err := readLine()
+	if err != nil && err != io.EOF {
+		fmt.Fprintln(os.Stderr, "")
+		return err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+
+	return errors.New(ERROR_NOT_CONFIRMED)
+}
+
+func containsOrder(orders []gemini.Order, orderId string) bool {
+	for _, order := range orders {
+		if order.OrderId == orderId {
+			return true
+		}
+	}
+	return false
+}
+
+// confirmOrder asks before placing a live order from a terminal. Sandbox
+// orders, non-interactive runs, and --yes go straight through.
+func confirmOrder(c *cli.Context, prompt string) error {
+	if !gemini_api_live || c.Bool("yes") || !isTerminal(os.Stdin) {
+		return nil
+	}
+	return confirm(prompt)
+}
+
+// eachTxid runs fn for each txid passed as an argument, or the txid flag,
+// printing the resulting orders. Failures are reported and skipped. With
+// several txids a summary follows, and JSON is printed as an array.
+func eachTxid(c *cli.Context, fn func(txid string) (gemini.Order, error)) error {
+	txids := []string(c.Args())
+	if len(txids) == 0 {
+		txids = []string{c.String("txid")}
+	}
+
+	var lastErr error
+	orders := make([]gemini.Order, 0, len(txids))
+
+	for _, txid := range txids {
+		order, err := fn(txid)
+		if err != nil {
+			lastErr = err
+			if len(txids) > 1 {
+				err = fmt.Errorf("%s: %v", txid, err)
+			}
+			printError(err)
+			continue
+		}
+
+		orders = append(orders, order)
+
+		if !jsonOutput(c) {
+			if len(orders) > 1 {
+				printSeparator()
+			}
+			printOrder(order)
+		}
+	}
+
+	if jsonOutput(c) && len(txids) == 1 {
+		if len(orders) == 1 {
+			printJSON(orders[0])
+		}
+	} else if jsonOutput(c) {
+		printJSON(orders)
+	}
+
+	if len(txids) == 1 {
+		return lastErr
+	}
+
+	failed := len(txids) - len(orders)
+
+	if !jsonOutput(c) && !quiet {
+		printSeparator()
+		fmt.Fprintf(stdout, "%s: %d, %s: %d\n", blue("Succeeded"), len(orders), blue("Failed"), failed)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d orders failed", failed, len(txids))
+	}
+
+	return nil
+}
+
+// fillMarketOrder sends immediate-or-cancel orders at the top of the book
+// for amount of quote currency, or baseAmount when amount is 0. Only one
+// order is sent unless unsafe is set, in which case it keeps going until
+// the remainder can't be filled any further, up to requoteLimit orders.
+// Fees are expected to already be taken out of amount. Every order is
+// sent with the same clientOrderId and tif execution option, and passed
+// to handle as it's placed. Closing stop ends the loop before the next
+// order.
+func fillMarketOrder(ex exchange, mkt, side, clientOrderId, tif string, amount, baseAmount float64, unsafe bool, requoteLimit int, stop <-chan struct{}, handle func(gemini.Order)) error {
+	requotes := 0
+
+	// fills are tracked in both currencies so the remainder is always
+	// worked out in the currency that was asked for
+	executedBase := 0.0
+	executedQuote := 0.0
+
+	details, err := getSymbolDetails(mkt)
+	if err != nil {
+		return err
+	}
+
+	// remaining amounts below these can't be filled any further
+	minAmt := details.MinOrderSize
+	if amount > 0 {
+		minAmt = details.QuoteIncrement
+	}
+
+	for {
+
+		if requotes >= requoteLimit {
+			return errors.New(ERROR_MAX_REQUOTES)
+		}
+
+		select {
+		case <-stop:
+			return errors.New(ERROR_INTERRUPTED)
+		default:
+		}
+
+		bookEntry, err := getOrderBookEntry(ex, mkt, side)
+		if err != nil {
+			return err
+		}
+
+		btcAmount := roundToIncrement(baseAmount-executedBase, details.TickSize)
+		if amount > 0 {
+			// round down so the order never spends more than what's left
+			btcAmount = floorToIncrement((amount-executedQuote)/bookEntry.Price, details.TickSize)
+		}
+
+		if btcAmount < details.MinOrderSize {
+			if requotes == 0 {
+				return fmt.Errorf("%s: %v", ERROR_BELOW_MIN_ORDER, details.MinOrderSize)
+			}
+			return nil
+		}
+
+		// commit trade
+		order, err := ex.NewOrder(mkt, clientOrderId, btcAmount, bookEntry.Price, side, []string{tif})
+		if err != nil {
+			return err
+		}
+
+		handle(order)
+
+		if !unsafe {
+			return nil
+		}
+
+		executedBase += order.ExecutedAmount
+		executedQuote += order.ExecutedAmount * order.AvgExecutionPrice
+
+		if (amount > 0 && amount-executedQuote <= minAmt) || (amount <= 0 && baseAmount-executedBase <= minAmt) {
+			return nil
+		}
+
+		requotes++
+	}
+}
+
+// filterBalances drops the balances with nothing in them.
+func filterBalances(balances []gemini.FundBalance) []gemini.FundBalance {
+	filtered := make([]gemini.FundBalance, 0, len(balances))
+
+	for _, fund := range balances {
+		if fund.Amount != 0 {
+			filtered = append(filtered, fund)
+		}
+	}
+
+	return filtered
+}
+
+// findBalance returns the balance of currency, or an empty one when the
+// account holds none.
+func findBalance(balances []gemini.FundBalance, currency string) gemini.FundBalance {
+	for _, fund := range balances {
+		if strings.EqualFold(fund.Currency, currency) {
+			return fund
+		}
+	}
+	return gemini.FundBalance{Currency: strings.ToUpper(currency)}
+}
+
+// filterOrders keeps the orders for mkt on side that were placed before
+// the given time in seconds. An empty or zero filter matches every order.
+func filterOrders(orders []gemini.Order, mkt, side string, before int64) []gemini.Order {
+	filtered := make([]gemini.Order, 0, len(orders))
+
+	for _, order := range orders {
+		if mkt != "" && !strings.EqualFold(order.Symbol, mkt) {
+			continue
+		}
+		if side != "" && !strings.EqualFold(order.Side, side) {
+			continue
+		}
+		if before > 0 && order.Timestamp >= before {
+			continue
+		}
+		filtered = append(filtered, order)
+	}
+
+	return filtered
+}
+
+// filterTrades keeps the trades at or after from and before to, both in
+// milliseconds. A zero bound is open.
+func filterTrades(trades []gemini.Trade, from, to int64) []gemini.Trade {
+	if from == 0 && to == 0 {
+		return trades
+	}
+
+	filtered := make([]gemini.Trade, 0, len(trades))
+	for _, trade := range trades {
+		ts := trade.Timestamp * 1000
+
+		if (from == 0 || ts >= from) && (to == 0 || ts < to) {
+			filtered = append(filtered, trade)
+		}
+	}
+
+	return filtered
+}
+
+// filterTransfers keeps the transfers in currency. An empty currency
+// matches every transfer.
+func filterTransfers(transfers []transfer, currency string) []transfer {
+	if currency == "" {
+		return transfers
+	}
+
+	filtered := make([]transfer, 0, len(transfers))
+	for _, t := range transfers {
+		if strings.EqualFold(t.Currency, currency) {
+			filtered = append(filtered, t)
+		}
+	}
+
+	return filtered
+}
+
+// floor rounds v down to decimals places, allowing for values that are a
+// hair under a whole number of places because of float error.
+func floor(v float64, decimals int) float64 {
+	pow := math.Pow(10, float64(decimals))
+	return math.Floor(v*pow+1e-9) / pow
+}
+
+// floorToIncrement rounds v down to a multiple of increment.
+func floorToIncrement(v, increment float64) float64 {
+	if increment <= 0 {
+		return v
+	}
+	return round(math.Floor(v/increment+1e-9)*increment, getDecimals(increment)+1)
+}
+
+// formatTimestamp renders a raw timestamp counted in unit as RFC3339 in
+// local time, or UTC with --utc. With --epoch the raw number is kept.
+func formatTimestamp(raw int64, unit time.Duration) string {
+	if timeEpoch {
+		return strconv.FormatInt(raw, 10)
+	}
+
+	t := time.Unix(0, raw*int64(unit))
+	if timeUTC {
+		t = t.UTC()
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+// getAccount combines the account endpoint with the roles of the key
+// making the request.
+func getAccount() (*accountInfo, error) {
+	var res struct {
+		Account struct {
+			AccountName string `json:"accountName"`
+			ShortName   string `json:"shortName"`
+			Type        string `json:"type"`
+			Created     int64  `json:"created,string"`
+		} `json:"account"`
+	}
+	err := withRetry(func() error {
+		return privateRequest("/v1/account", nil, &res)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var roles struct {
+		IsAuditor     bool `json:"isAuditor"`
+		IsFundManager bool `json:"isFundManager"`
+		IsTrader      bool `json:"isTrader"`
+	}
+	err = withRetry(func() error {
+		return privateRequest("/v1/roles", nil, &roles)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info := &accountInfo{
+		Name:      res.Account.AccountName,
+		ShortName: res.Account.ShortName,
+		Type:      res.Account.Type,
+		CreatedMS: res.Account.Created,
+		Roles:     []string{},
+		Live:      gemini_api_live,
+	}
+
+	if roles.IsAuditor {
+		info.Roles = append(info.Roles, "auditor")
+	}
+	if roles.IsFundManager {
+		info.Roles = append(info.Roles, "fund-manager")
+	}
+	if roles.IsTrader {
+		info.Roles = append(info.Roles, "trader")
+	}
+
+	return info, nil
+}
+
+// getAllTrades pages through PastTrades from timestamp onward, moving the
+// cursor up to the newest trade of each page until no new trades come
+// back. The boundary trade reappears on the next page, so trades are
+// de-duplicated by id. Trades are returned newest first like PastTrades.
+func getAllTrades(ex exchange, mkt string, timestamp int64) ([]gemini.Trade, error) {
+	seen := map[string]bool{}
+	all := make([]gemini.Trade, 0, TRADES_PAGE_SIZE)
+
+	for {
+		var page []gemini.Trade
+		err := withRetry(func() (err error) {
+			page, err = ex.PastTrades(mkt, TRADES_PAGE_SIZE, timestamp)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		added := 0
+		for _, trade := range page {
+			id := fmt.Sprintf("%v", trade.TradeId)
+			if seen[id] {
+				continue
+			}
+
+			seen[id] = true
+			all = append(all, trade)
+			added++
+
+			if ts := trade.Timestamp * 1000; ts > timestamp {
+				timestamp = ts
+			}
+		}
+
+		if added == 0 || len(page) < TRADES_PAGE_SIZE {
+			break
+		}
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Timestamp > all[j].Timestamp
+	})
+
+	return all, nil
+}
+
+// getAllTransfers pages through the transfers from timestamp onward the
+// same way getAllTrades does, de-duplicating the boundary transfer by eid.
+func getAllTransfers(timestamp int64) ([]transfer, error) {
+	seen := map[int64]bool{}
+	all := make([]transfer, 0, TRANSFERS_PAGE_SIZE)
+
+	for {
+		page, err := getTransfers(TRANSFERS_PAGE_SIZE, timestamp)
+		if err != nil {
+			return nil, err
+		}
+
+		added := 0
+		for _, t := range page {
+			if seen[t.Eid] {
+				continue
+			}
+
+			seen[t.Eid] = true
+			all = append(all, t)
+			added++
+
+			if t.TimestampMS > timestamp {
+				timestamp = t.TimestampMS
+			}
+		}
+
+		if added == 0 || len(page) < TRANSFERS_PAGE_SIZE {
+			break
+		}
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].TimestampMS > all[j].TimestampMS
+	})
+
+	return all, nil
+}
+
+// checkCandleInterval fails unless interval is one of CANDLE_INTERVALS.
+func checkCandleInterval(interval string) error {
+	for _, i := range CANDLE_INTERVALS {
+		if i == interval {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %s", ERROR_CANDLE_INTERVAL, strings.Join(CANDLE_INTERVALS, ", "))
+}
+
+// getCandles returns candles for mkt over the given time frame, most
+// recent first.
+func getCandles(mkt, interval string) ([]candle, error) {
+	var res [][]float64
+	err := withRetry(func() error {
+		return publicRequest("/v2/candles/"+mkt+"/"+interval, &res)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	candles := make([]candle, 0, len(res))
+	for _, values := range res {
+		if len(values) < 6 {
+			continue
+		}
+
+		candles = append(candles, candle{
+			Timestamp: int64(values[0]),
+			Open:      values[1],
+			High:      values[2],
+			Low:       values[3],
+			Close:     values[4],
+			Volume:    values[5],
+		})
+	}
+
+	return candles, nil
+}
+
+// getMarketTrades returns the market's public trades since the given time
+// in milliseconds, newest first. The endpoint returns at most
+// TRADES_PAGE_SIZE trades, so a busy market is cut down to the most recent.
+func getMarketTrades(mkt string, since int64) ([]marketTrade, error) {
+	query := url.Values{}
+	query.Set("timestamp", strconv.FormatInt(since, 10))
+	query.Set("limit_trades", strconv.Itoa(TRADES_PAGE_SIZE))
+
+	var trades []marketTrade
+	err := withRetry(func() error {
+		return publicRequest("/v1/trades/"+mkt+"?"+query.Encode(), &trades)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return trades, nil
+}
+
+// getClientOrderId returns the client-order-id flag, or a new id when it
+// wasn't passed.
+func getClientOrderId(c *cli.Context) string {
+	if id := c.String("client-order-id"); id != "" {
+		return id
+	}
+	return newClientOrderId()
+}
+
+// getDateRange converts the from and to dates into millisecond bounds,
+// with to covering the whole of its day. An empty date gives a zero bound.
+func getDateRange(from, to, tz string) (int64, int64, error) {
+	var start, end int64
+
+	if from != "" {
+		t, err := getTimeFromDate(from, tz)
+		if err != nil {
+			return 0, 0, err
+		}
+		start = t
+	}
+
+	if to != "" {
+		day, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		t, err := getTimeFromDate(day.AddDate(0, 0, 1).Format("2006-01-02"), tz)
+		if err != nil {
+			return 0, 0, err
+		}
+		end = t
+	}
+
+	if start > 0 && end > 0 && end <= start {
+		return 0, 0, errors.New(ERROR_INVALID_RANGE)
+	}
+
+	return start, end, nil
+}
+
+// getDepositAddress returns the most recent deposit address for currency,
+// matching label when one is given, or nil if there isn't one yet.
+func getDepositAddress(currency, label string) (*depositAddressResult, error) {
+	network, ok := DEPOSIT_NETWORKS[currency]
+	if !ok {
+		return nil, fmt.Errorf("%s: %s", ERROR_UNKNOWN_CURRENCY, currency)
+	}
+
+	var addresses []depositAddressResult
+	err := withRetry(func() error {
+		return privateRequest("/v1/addresses/"+network, nil, &addresses)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range addresses {
+		if label == "" || addr.Label == label {
+			addr.Currency = currency
+			return &addr, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// getDecimals returns the number of decimal places given by an increment
+// such as a symbol's tick size, e.g. 0.000001 is 6.
+func getDecimals(increment float64) int {
+	if increment <= 0 || increment >= 1 {
+		return 0
+	}
+	return int(math.Round(-math.Log10(increment)))
+}
+
+// getEnv returns the environment variable key, or fallback when unset.
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// getFeeBps returns the maker or taker fee for an order. When the specific
+// flag wasn't passed it falls back to the deprecated bps flag, the config
+// file default, the account's fees, and finally DEFAULT_FEE_BPS. Paper
+// orders use the fees the paper portfolio charges instead of the account's.
+func getFeeBps(c *cli.Context, maker bool) int {
+	name := "taker-bps"
+	if maker {
+		name = "maker-bps"
+	}
+
+	if c.IsSet(name) {
+		return c.Int(name)
+	}
+
+	if c.IsSet("bps") {
+		return c.Int("bps")
+	}
+
+	if cfg.Bps > 0 {
+		return cfg.Bps
+	}
+
+	if paperTrading {
+		if maker {
+			return PAPER_MAKER_FEE_BPS
+		}
+		return PAPER_TAKER_FEE_BPS
+	}
+
+	volume, err := getNotionalVolume()
+	if err != nil {
+		slog.Warn("Unable to fetch the account fees, assuming the default", "bps", DEFAULT_FEE_BPS, "error", err)
+		return DEFAULT_FEE_BPS
+	}
+
+	if maker {
+		return volume.MakerFeeBps
+	}
+	return volume.TakerFeeBps
+}
+
 func getFeeRatio(bps int) float64 {
 	return float64(bps) / 10000
 }
 
-func getOrderBookEntry(mkt, side string) (*gemini.BookEntry, error) {
-	book, err := g.OrderBook(mkt, 1, 1)
+// getExitCode returns the process exit code for err, distinguishing known
+// Gemini error reasons from everything else.
+func getExitCode(err error) int {
+	if apiErr := parseApiError(err); apiErr != nil {
+		if reason, ok := API_ERROR_REASONS[apiErr.Reason]; ok {
+			return reason.ExitCode
+		}
+		return EXIT_API_ERROR
+	}
+
+	if isInterrupted(err) {
+		return EXIT_INTERRUPTED
+	}
+
+	var re *retryableError
+	if errors.As(err, &re) {
+		if strings.Contains(re.Error(), "429") {
+			return EXIT_RATE_LIMITED
+		}
+		return EXIT_API_ERROR
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return EXIT_NETWORK
+	}
+
+	msg := err.Error()
+	if strings.HasPrefix(msg, ERROR_ORDER_NOT_FOUND) {
+		return EXIT_NOT_FOUND
+	}
+
+	if strings.HasPrefix(msg, ERROR_API_KEY_MISSING) || strings.HasPrefix(msg, ERROR_STREAM_AUTH) {
+		return EXIT_AUTH_ERROR
+	}
+
+	for _, s := range USAGE_ERRORS {
+		if strings.HasPrefix(msg, s) {
+			return EXIT_USAGE
+		}
+	}
+
+	return EXIT_ERROR
+}
+
+// getLimitAmount converts amount of quote currency, net of fees, into a
+// base amount at price, or rounds baseAmount when amount is 0. The result
+// is checked against the market's minimum order size.
+func getLimitAmount(mkt, side string, amount, baseAmount, price float64, bps int) (float64, error) {
+	details, err := getSymbolDetails(mkt)
+	if err != nil {
+		return 0, err
+	}
+
+	feeRatio := getFeeRatio(bps)
+
+	if side == "buy" {
+		amount -= amount * feeRatio
+	} else {
+		amount += amount * feeRatio
+	}
+
+	var btcAmount float64
+
+	// amounts are sized in multiples of the market's quantity increment
+	if amount > 0 {
+		btcAmount = roundToIncrement(amount/price, details.TickSize)
+	} else {
+		btcAmount = roundToIncrement(baseAmount, details.TickSize)
+		if btcAmount != baseAmount {
+			slog.Warn("Rounded amount to the quantity increment", "amount", baseAmount, "rounded", btcAmount, "increment", details.TickSize)
+		}
+	}
+
+	if btcAmount < details.MinOrderSize {
+		return 0, fmt.Errorf("%s: %v", ERROR_BELOW_MIN_ORDER, details.MinOrderSize)
+	}
+
+	return btcAmount, nil
+}
+
+// getLimitPrice rounds price to the nearest multiple of the market's price
+// increment, warning when that changes it. In strict mode a price that
+// needs rounding is an error instead.
+func getLimitPrice(mkt string, price float64, strict bool) (float64, error) {
+	details, err := getSymbolDetails(mkt)
+	if err != nil {
+		return 0, err
+	}
+
+	rounded := roundToIncrement(price, details.QuoteIncrement)
+	if rounded == price {
+		return price, nil
+	}
+
+	if strict {
+		return 0, fmt.Errorf("%s: %v", ERROR_PRICE_INCREMENT, details.QuoteIncrement)
+	}
+
+	slog.Warn("Rounded price to the price increment", "price", price, "rounded", rounded, "increment", details.QuoteIncrement)
+
+	return rounded, nil
+}
+
+// getMarket returns the mkt flag, falling back to the config file default
+// when the flag wasn't passed.
+func getMarket(c *cli.Context) string {
+	if !c.IsSet("mkt") && cfg.Market != "" {
+		return cfg.Market
+	}
+	return c.String("mkt")
+}
+
+// getMarkets returns the markets of a comma separated mkt flag along with
+// any positional arguments after the first, which beforeArgs has already
+// put in mkt. Duplicates are dropped.
+func getMarkets(c *cli.Context) []string {
+	names := strings.Split(getMarket(c), ",")
+	names = append(names, c.Args().Tail()...)
+
+	seen := map[string]bool{}
+	markets := make([]string, 0, len(names))
+
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		markets = append(markets, name)
+	}
+
+	return markets
+}
+
+func getNotionalVolume() (*notionalVolume, error) {
+	volume := &notionalVolume{}
+	err := withRetry(func() error {
+		return privateRequest("/v1/notionalvolume", nil, volume)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return volume, nil
+}
+
+// getOrderBookEntry returns the best level on the side of the book an
+// order on side would fill against, failing when the book is stale.
+func getOrderBookEntry(ex exchange, mkt, side string) (*gemini.BookEntry, error) {
+	entries, err := getOrderBookSide(ex, mkt, side, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkBookAge(mkt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entries[0], nil
+}
+
+// getOrdersByClientId returns every order placed with the client order id,
+// live or not.
+func getOrdersByClientId(clientOrderId string) ([]gemini.Order, error) {
+	if clientOrderId == "" {
+		return nil, errors.New(ERROR_MISSING_CLIENT)
+	}
+
+	params := map[string]interface{}{
+		"client_order_id": clientOrderId,
+		"include_trades":  false,
+	}
+
+	var orders []gemini.Order
+	err := withRetry(func() error {
+		return privateRequest("/v1/order/status", params, &orders)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("%s: %s", ERROR_ORDER_NOT_FOUND, clientOrderId)
+	}
+
+	return orders, nil
+}
+
+// getOrderBookSide returns up to lim levels of the side of the book an
+// order on side would fill against, best price first. A lim of 0 returns
+// the full book.
+func getOrderBookSide(ex exchange, mkt, side string, lim int) ([]gemini.BookEntry, error) {
+	var book gemini.Book
+	err := withRetry(func() (err error) {
+		book, err = ex.OrderBook(mkt, lim, lim)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if side == "buy" {
+		if len(book.Asks) < 1 {
+			return nil, errors.New(ERROR_NO_ASKS)
+		}
+
+		return book.Asks, nil
+	}
+
+	if len(book.Bids) < 1 {
+		return nil, errors.New(ERROR_NO_BIDS)
+	}
+
+	return book.Bids, nil
+}
+
+// getPctAmount sizes an order as pct percent of the available balance it
+// would spend: the quote currency for buys, returned as an amount, and the
+// base currency for sells, returned as a base amount.
+func getPctAmount(ex exchange, mkt, side string, pct float64) (float64, float64, error) {
+	details, err := getSymbolDetails(mkt)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	currency := details.BaseCurrency
+	if side == "buy" {
+		currency = details.QuoteCurrency
+	}
+
+	var balances []gemini.FundBalance
+	err = withRetry(func() (err error) {
+		balances, err = ex.Balances()
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	available := 0.0
+	for _, fund := range balances {
+		if strings.EqualFold(fund.Currency, currency) {
+			available = fund.Available
+		}
+	}
+
+	if side == "buy" {
+		return available * pct / 100, 0, nil
+	}
+	return 0, available * pct / 100, nil
+}
+
+// getPrice returns the current price of mkt given by one of PRICE_FIELDS.
+func getPrice(ex exchange, mkt, field string) (float64, error) {
+	switch field {
+	case "last":
+		var t gemini.Ticker
+		err := withRetry(func() (err error) {
+			t, err = ex.Ticker(mkt)
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+		return t.Last, nil
+	case "mid", "bid", "ask":
+		top, err := getTopOfBook(ex, mkt)
+		if err != nil {
+			return 0, err
+		}
+
+		switch field {
+		case "bid":
+			return top.Bid, nil
+		case "ask":
+			return top.Ask, nil
+		}
+		return top.Mid, nil
+	}
+
+	return 0, fmt.Errorf("%s: %s", ERROR_INVALID_FIELD, strings.Join(PRICE_FIELDS, ", "))
+}
+
+// getTopOfBook fetches the best bid and ask of mkt in one request.
+func getTopOfBook(ex exchange, mkt string) (*topOfBook, error) {
+	var book gemini.Book
+	err := withRetry(func() (err error) {
+		book, err = ex.OrderBook(mkt, 1, 1)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(book.Bids) < 1 {
+		return nil, errors.New(ERROR_NO_BIDS)
+	}
+
+	if len(book.Asks) < 1 {
+		return nil, errors.New(ERROR_NO_ASKS)
+	}
+
+	top := &topOfBook{
+		Bid: book.Bids[0].Price,
+		Ask: book.Asks[0].Price,
+	}
+
+	top.Spread = top.Ask - top.Bid
+	top.Mid = (top.Ask + top.Bid) / 2
+	top.SpreadBps = top.Spread / top.Mid * 10000
+
+	return top, nil
+}
+
+// getTopQuote adds the last trade price to the top of the book.
+func getTopQuote(ex exchange, mkt string) (*topQuote, error) {
+	top, err := getTopOfBook(ex, mkt)
+	if err != nil {
+		return nil, err
+	}
+
+	var t gemini.Ticker
+	err = withRetry(func() (err error) {
+		t, err = ex.Ticker(mkt)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &topQuote{*top, t.Last}, nil
+}
+
+// getSymbols returns the exchange's market symbols, fetching them once per
+// process.
+func getSymbols(ex exchange) ([]string, error) {
+	loadSymbolCache()
+
+	if symbols != nil {
+		return symbols, nil
+	}
+
+	var res []string
+	err := withRetry(func() (err error) {
+		res, err = ex.Symbols()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	symbols = res
+	saveSymbolCache()
+
+	return symbols, nil
+}
+
+// getSymbolDetails returns the tick size, quote increment, and minimum
+// order size for mkt, fetching each symbol once per process or less often
+// from the cache file.
+func getSymbolDetails(mkt string) (*symbolDetails, error) {
+	loadSymbolCache()
+
+	if details, ok := symbolDetailsCache[mkt]; ok {
+		return details, nil
+	}
+
+	details := &symbolDetails{}
+	err := withRetry(func() error {
+		return publicRequest("/v1/symbols/details/"+mkt, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	symbolDetailsCache[mkt] = details
+	saveSymbolCache()
+
+	return details, nil
+}
+
+// getTransfers returns up to lim deposits and withdrawals from timestamp
+// onward, newest first.
+func getTransfers(lim int, timestamp int64) ([]transfer, error) {
+	params := map[string]interface{}{
+		"limit_transfers": lim,
+	}
+	if timestamp > 0 {
+		params["timestamp"] = timestamp
+	}
+
+	var transfers []transfer
+	err := withRetry(func() error {
+		return privateRequest("/v1/transfers", params, &transfers)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+// getTickers fetches the tickers of markets with up to TICKER_WORKERS
+// requests at a time, sorted by market. A market that fails carries its
+// error rather than failing the others.
+func getTickers(ex exchange, markets []string) []marketTicker {
+	tickers := make([]marketTicker, len(markets))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < TICKER_WORKERS && w < len(markets); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				var t gemini.Ticker
+				err := withRetry(func() (err error) {
+					t, err = ex.Ticker(markets[i])
+					return err
+				})
+
+				tickers[i] = marketTicker{Market: markets[i], Bid: t.Bid, Ask: t.Ask, Last: t.Last}
+				if err != nil {
+					tickers[i] = marketTicker{Market: markets[i], Error: err.Error()}
+				}
+			}
+		}()
+	}
+
+	for i := range markets {
+		jobs <- i
+	}
+	close(jobs)
+
+	wg.Wait()
+
+	sort.Slice(tickers, func(i, j int) bool {
+		return tickers[i].Market < tickers[j].Market
+	})
+
+	return tickers
+}
+
+// getTimeFromDate parses a YYYY-MM-DD date as midnight in the IANA zone
+// tz, or local time when tz is empty, and returns the millisecond
+// timestamp that the time flag takes.
+func getTimeFromDate(date, tz string) (int64, error) {
+	loc := time.Local
+
+	if tz != "" {
+		var err error
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return 0, err
+	}
+
+	return t.UnixNano() / int64(time.Millisecond), nil
+}
+
+// humanizeDuration renders d in its two largest units, e.g. "45s", "3m",
+// "2h15m" or "4d6h". Seconds only show under a minute.
+func humanizeDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+
+	const day = 24 * time.Hour
+
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", d/time.Second)
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d < day:
+		if m := d % time.Hour / time.Minute; m > 0 {
+			return fmt.Sprintf("%dh%dm", d/time.Hour, m)
+		}
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+
+	if h := d % day / time.Hour; h > 0 {
+		return fmt.Sprintf("%dd%dh", d/day, h)
+	}
+	return fmt.Sprintf("%dd", d/day)
+}
+
+// isInterrupted reports whether err came from a request or wait that was
+// cut short by Ctrl-C. The gemini package doesn't always wrap its errors,
+// so requestCtx itself is checked too.
+func isInterrupted(err error) bool {
+	return errors.Is(err, context.Canceled) || requestCtx.Err() != nil || err.Error() == ERROR_INTERRUPTED
+}
+
+// isRetryable reports whether err is a rate limit or server error worth
+// another attempt. The gemini package doesn't type its errors, so those are
+// recognized by their message.
+func isRetryable(err error) bool {
+	var re *retryableError
+	if errors.As(err, &re) {
+		return true
+	}
+
+	msg := err.Error()
+	for _, s := range RETRYABLE_ERRORS {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jsonOutput reports whether a command should print its result as JSON,
+// which is also the path a --format template is applied on.
+func jsonOutput(c *cli.Context) bool {
+	return c.Bool("json") || outputFormat != nil
+}
+
+// isTerminalOutput reports whether stdout is a terminal, which is when
+// watch modes redraw in place rather than appending.
+func isTerminalOutput() bool {
+	f, ok := stdout.(*os.File)
+	return ok && isTerminal(f)
+}
+
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// ladderPrices spaces n prices from from to to, both included, rounded to
+// decimals. Geometric spacing keeps a constant ratio between neighbours
+// rather than a constant difference.
+func ladderPrices(from, to float64, n int, geometric bool, decimals int) []float64 {
+	prices := make([]float64, n)
+
+	for i := range prices {
+		t := 0.0
+		if n > 1 {
+			t = float64(i) / float64(n-1)
+		}
+
+		if geometric {
+			prices[i] = round(from*math.Pow(to/from, t), decimals)
+		} else {
+			prices[i] = round(from+(to-from)*t, decimals)
+		}
+	}
+
+	return prices
+}
+
+// newClientOrderId returns a random version 4 UUID.
+func newClientOrderId() string {
+	b := make([]byte, 16)
+	crand.Read(b)
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func newTabWriter() *tabwriter.Writer {
+	return tabwriter.NewWriter(stdout, 0, 0, 1, ' ', 0)
+}
+
+// orderAge is how long ago order was placed.
+func orderAge(order gemini.Order) string {
+	return humanizeDuration(now().Sub(time.Unix(order.Timestamp, 0)))
+}
+
+func orderTable(orders []gemini.Order) ([]string, [][]string) {
+	header := []string{
+		"OrderId",
+		"Timestamp",
+		"Age",
+		"Symbol",
+		"Side",
+		"Price",
+		"OriginalAmount",
+		"ExecutedAmount",
+		"RemainingAmount",
+		"AvgExecutionPrice",
+		"IsLive",
+		"IsCancelled",
+	}
+
+	rows := make([][]string, 0, len(orders))
+	for _, order := range orders {
+		rows = append(rows, []string{
+			fmt.Sprintf("%v", order.OrderId),
+			formatTimestamp(order.Timestamp, time.Second),
+			orderAge(order),
+			order.Symbol,
+			order.Side,
+			fmt.Sprintf("%.*f", precision, order.Price),
+			fmt.Sprintf("%.*f", precision, order.OriginalAmount),
+			fmt.Sprintf("%.*f", precision, order.ExecutedAmount),
+			fmt.Sprintf("%.*f", precision, order.RemainingAmount),
+			fmt.Sprintf("%.*f", precision, order.AvgExecutionPrice),
+			strconv.FormatBool(order.IsLive),
+			strconv.FormatBool(order.IsCancelled),
+		})
+	}
+
+	return header, rows
+}
+
+// parseApiError extracts the reason and message of a Gemini error response
+// from err, or returns nil if err didn't come from the exchange. Requests
+// made directly return an *apiError; errors from the gemini package are
+// matched on their message.
+func parseApiError(err error) *apiError {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	msg := err.Error()
+
+	apiErr = &apiError{}
+	if json.Unmarshal([]byte(msg), apiErr) == nil && apiErr.Reason != "" {
+		return apiErr
+	}
+
+	for reason := range API_ERROR_REASONS {
+		if strings.Contains(msg, reason) {
+			message := strings.TrimSpace(strings.TrimPrefix(msg, reason))
+			message = strings.TrimSpace(strings.TrimPrefix(message, ":"))
+
+			return &apiError{Result: "error", Reason: reason, Message: message}
+		}
+	}
+
+	return nil
+}
+
+// parseTrail parses --trail as a price distance, or a percentage of the
+// price when it ends in %.
+func parseTrail(trail string) (float64, bool, error) {
+	pct := strings.HasSuffix(trail, "%")
+
+	distance, err := strconv.ParseFloat(strings.TrimSuffix(trail, "%"), 64)
+	if err != nil || distance <= 0 || (pct && distance >= 100) {
+		return 0, false, fmt.Errorf("%s: %s", ERROR_INVALID_TRAIL, trail)
+	}
+
+	return distance, pct, nil
+}
+
+// printAvailable prints the free amount of a single currency as a bare
+// number.
+func printAvailable(balances []gemini.FundBalance, currency string) error {
+	if currency == "" {
+		err := errors.New(ERROR_INVALID_CURRENCY)
+		printError(err)
+		return err
+	}
+
+	fund := findBalance(balances, currency)
+	fmt.Fprintln(stdout, strconv.FormatFloat(fund.Available, 'f', -1, 64))
+
+	return nil
+}
+
+// printBalances lists the total, available and withdrawable amount of each
+// balance, along with its value and the grand total from report when there
+// is one.
+func printBalances(balances []gemini.FundBalance, report *portfolioReport) {
+	w := newTabWriter()
+
+	for _, fund := range balances {
+		fmt.Fprintf(w, "%s:\t%v\t%v available\t%v withdrawable", blue(fund.Currency), fund.Amount, fund.Available, fund.AvailableForWithdrawal)
+
+		if h, ok := report.find(fund.Currency); ok {
+			if h.Priced {
+				fmt.Fprintf(w, "\t%.2f %s", h.Value, report.Quote)
+			} else {
+				fmt.Fprintf(w, "\t%s", red("unpriced"))
+			}
+		}
+
+		fmt.Fprintln(w, "")
+	}
+
+	if report != nil {
+		fmt.Fprintf(w, "%s:\t\t\t\t%s\n", blue("Total"), boldWhite(fmt.Sprintf("%.2f %s", report.Total, report.Quote)))
+	}
+
+	w.Flush()
+}
+
+func printBalancesCSV(balances []gemini.FundBalance, fields string) error {
+	header, rows := balanceTable(balances)
+
+	header, rows, err := selectColumns(header, rows, fields)
+	if err != nil {
+		return err
+	}
+
+	return writeCSV(header, rows)
+}
+
+// printBook prints asks above bids with the best prices in the middle.
+// When cumulative is set each level also shows the running amount and
+// notional from the best price outward.
+func printBook(book gemini.Book, cumulative bool) {
+	askRows := bookRows(book.Asks, cumulative)
+	bidRows := bookRows(book.Bids, cumulative)
+
+	rows := make([][]string, 0, len(askRows)+len(bidRows))
+	for i := len(askRows) - 1; i >= 0; i-- {
+		rows = append(rows, askRows[i])
+	}
+	rows = append(rows, bidRows...)
+
+	// align on the plain text, then color the leading price of each line
+	lines := alignColumns(rows)
+	askLines, bidLines := lines[:len(book.Asks)], lines[len(book.Asks):]
+
+	for i, line := range askLines {
+		price := rows[i][0]
+
+		if i == len(askLines)-1 {
+			fmt.Fprintln(stdout, boldWhite(price)+line[len(price):])
+		} else {
+			fmt.Fprintln(stdout, blue(price)+line[len(price):])
+		}
+	}
+
+	fmt.Fprintln(stdout, "")
+
+	for i, line := range bidLines {
+		price := rows[len(askLines)+i][0]
+
+		if i == 0 {
+			fmt.Fprintln(stdout, boldWhite(price)+line[len(price):])
+		} else {
+			fmt.Fprintln(stdout, blue(price)+line[len(price):])
+		}
+	}
+}
+
+func printError(err error) {
+	if isInterrupted(err) {
+		err = errors.New(ERROR_INTERRUPTED)
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("%s: %v", ERROR_TIMEOUT, err)
+	}
+
+	if apiErr := parseApiError(err); apiErr != nil {
+		if reason, ok := API_ERROR_REASONS[apiErr.Reason]; ok {
+			err = fmt.Errorf("%s: %s", reason.Description, apiErr.Message)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: %s\n", red("Error"), redact(err.Error()))
+	fmt.Fprintf(os.Stderr, "")
+	return
+}
+
+// printCancelResult prints a count of the cancelled, rejected and skipped
+// orders followed by each order id with what happened to it. With --quiet
+// only the cancelled ids are printed.
+func printCancelResult(res gemini.CancelResult, skipped []string) {
+	cancelled := res.Details.CancelledOrders
+	rejected := res.Details.CancelRejects
+
+	if quiet {
+		for _, id := range cancelled {
+			fmt.Fprintln(stdout, id)
+		}
+		return
+	}
+
+	counts := fmt.Sprintf("%s %d, %s %d", blue("Cancelled"), len(cancelled), blue("rejected"), len(rejected))
+	if skipped != nil {
+		counts += fmt.Sprintf(", %s %d", blue("skipped"), len(skipped))
+	}
+	fmt.Fprintln(stdout, counts)
+
+	w := newTabWriter()
+
+	for _, id := range cancelled {
+		fmt.Fprintf(w, "%v\t%s\n", id, "cancelled")
+	}
+	for _, id := range rejected {
+		fmt.Fprintf(w, "%v\t%s\n", id, red("rejected"))
+	}
+	for _, id := range skipped {
+		fmt.Fprintf(w, "%v\t%s\n", id, "skipped")
+	}
+
+	w.Flush()
+}
+
+func printConversion(res conversion, details *symbolDetails) {
+	baseDecimals := getDecimals(details.TickSize)
+	quoteDecimals := getDecimals(details.QuoteIncrement)
+
+	w := newTabWriter()
+
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("Price"), precision, res.Price)
+	fmt.Fprintf(w, "%s:\t%.*f %s\n", blue("BaseAmount"), baseDecimals, res.BaseAmount, details.BaseCurrency)
+	fmt.Fprintf(w, "%s:\t%.*f %s\n", blue("QuoteAmount"), quoteDecimals, res.QuoteAmount, details.QuoteCurrency)
+
+	if res.FeeBps > 0 {
+		fmt.Fprintf(w, "%s:\t%.*f %s (%d bps)\n", blue("Fee"), quoteDecimals, res.Fee, details.QuoteCurrency, res.FeeBps)
+	}
+
+	w.Flush()
+}
+
+func printDcaRound(res dcaRound, spec orderSpec, count int) {
+	round := strconv.Itoa(res.Round)
+	if count > 0 {
+		round = fmt.Sprintf("%d/%d", res.Round, count)
+	}
+
+	prefix := fmt.Sprintf("%s %s %s: %s", formatTimestamp(res.Timestamp, time.Second), blue("Round"), round, spec)
+
+	switch {
+	case res.Error != "":
+		fmt.Fprintf(stdout, "%s: %s\n", prefix, red(res.Error))
+	case res.Order == nil:
+		fmt.Fprintf(stdout, "%s: %s\n", prefix, "ok")
+	default:
+		fmt.Fprintf(stdout, "%s: %s executed %v @ %v\n", prefix, boldWhite(res.Order.OrderId), res.Order.ExecutedAmount, res.Order.AvgExecutionPrice)
+	}
+}
+
+func printFill(fill bookFill) {
+	w := newTabWriter()
+
+	fmt.Fprintf(w, "%s:\t%s\n", blue("AvgPrice"), boldWhite(fmt.Sprintf("%.*f", precision, fill.AvgPrice)))
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("BestPrice"), precision, fill.BestPrice)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("WorstPrice"), precision, fill.WorstPrice)
+	fmt.Fprintf(w, "%s:\t%.2f\n", blue("SlippageBps"), fill.SlippageBps)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("BaseAmount"), precision, fill.BaseAmount)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("QuoteAmount"), precision, fill.QuoteAmount)
+	fmt.Fprintf(w, "%s:\t%d\n", blue("Levels"), fill.Levels)
+
+	if fill.Shortfall > 0 {
+		fmt.Fprintf(w, "%s:\t%s\n", blue("Shortfall"), red(fmt.Sprintf("%.*f", precision, fill.Shortfall)))
+	}
+
+	w.Flush()
+}
+
+// printJSON prints v as compact JSON, or indented with the keys colored
+// when --pretty is set.
+func printJSON(v interface{}) {
+	if outputFormat != nil {
+		printFormat(v)
+		return
+	}
+
+	if !prettyJSON {
+		chars, _ := json.Marshal(v)
+		fmt.Fprintln(stdout, string(chars))
+		return
+	}
+
+	chars, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Fprintln(stdout, colorizeJSON(chars))
+}
+
+func printHeartbeat(c *cli.Context, res *heartbeatResult) {
+	if jsonOutput(c) {
+		printJSON(res)
+		return
+	}
+
+	fmt.Fprintf(stdout, "%s %s\n", formatTimestamp(res.Timestamp, time.Millisecond), boldWhite(res.Result))
+}
+
+func printFillSummary(summary fillSummary) {
+	if quiet {
+		return
+	}
+
+	w := newTabWriter()
+
+	fmt.Fprintf(w, "%s:\t%d\n", blue("Orders"), summary.Orders)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("ExecutedAmount"), precision, summary.BaseAmount)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("QuoteAmount"), precision, summary.QuoteAmount)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("AvgPrice"), boldWhite(fmt.Sprintf("%.*f", precision, summary.AvgPrice)))
+
+	w.Flush()
+}
+
+func printMmReport(res mmReport) {
+	w := newTabWriter()
+
+	fmt.Fprintf(w, "%s:\t%d\n", blue("Placed"), res.Placed)
+	fmt.Fprintf(w, "%s:\t%d\n", blue("Repriced"), res.Repriced)
+	fmt.Fprintf(w, "%s:\t%.*f for %.*f\n", blue("Bought"), precision, res.BaseBought, precision, res.QuoteSpent)
+	fmt.Fprintf(w, "%s:\t%.*f for %.*f\n", blue("Sold"), precision, res.BaseSold, precision, res.QuoteReceived)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Position"), boldWhite(fmt.Sprintf("%.*f", precision, res.Position)))
+
+	w.Flush()
+}
+
+// printOrder prints the fields of order, or only its id with --quiet.
+func printOrder(order gemini.Order) {
+	if quiet {
+		fmt.Fprintln(stdout, order.OrderId)
+		return
+	}
+
+	w := newTabWriter()
+
+	fmt.Fprintf(w, "%s:\t%s\n", blue("OrderId"), boldWhite(order.OrderId))
+	fmt.Fprintf(w, "%s:\t%s\n", blue("ClientOrderId"), order.ClientOrderId)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Timestamp"), formatTimestamp(order.Timestamp, time.Second))
+	if order.IsLive {
+		fmt.Fprintf(w, "%s:\t%s\n", blue("Age"), orderAge(order))
+	}
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Symbol"), order.Symbol)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Side"), order.Side)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Type"), order.Type)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Options"), strings.Join(order.Options, ", "))
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("Price"), precision, order.Price)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("OriginalAmount"), precision, order.OriginalAmount)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("ExecutedAmount"), precision, order.ExecutedAmount)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("RemainingAmount"), precision, order.RemainingAmount)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("AvgExecutionPrice"), precision, order.AvgExecutionPrice)
+	fmt.Fprintf(w, "%s:\t%v\n", blue("IsLive"), order.IsLive)
+	fmt.Fprintf(w, "%s:\t%v\n", blue("IsCancelled"), order.IsCancelled)
+
+	w.Flush()
+}
+
+func printOrdersCSV(orders []gemini.Order, fields string) error {
+	header, rows := orderTable(orders)
 
+	header, rows, err := selectColumns(header, rows, fields)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if side == "buy" {
-		if len(book.Asks) < 1 {
-			return nil, errors.New(ERROR_NO_ASKS)
+	return writeCSV(header, rows)
+}
+
+func printOrdersTable(orders []gemini.Order, fields string) error {
+	header, rows := orderTable(orders)
+
+	header, rows, err := selectColumns(header, rows, fields)
+	if err != nil {
+		return err
+	}
+
+	printTable(header, rows)
+	return nil
+}
+
+// printSeparator prints the blank line between blocks of output, which is
+// left out with --quiet.
+func printSeparator() {
+	if !quiet {
+		fmt.Fprintln(stdout, "")
+	}
+}
+
+// printTable prints rows as aligned columns beneath a highlighted header.
+func printTable(header []string, rows [][]string) {
+	lines := alignColumns(append([][]string{header}, rows...))
+
+	fmt.Fprintln(stdout, blue(lines[0]))
+	for _, line := range lines[1:] {
+		fmt.Fprintln(stdout, line)
+	}
+}
+
+func printTickers(tickers []marketTicker) {
+	header := []string{"Market", "Bid", "Ask", "Last", "Error"}
+
+	rows := make([][]string, 0, len(tickers))
+	for _, t := range tickers {
+		if t.Error != "" {
+			rows = append(rows, []string{t.Market, "", "", "", t.Error})
+			continue
 		}
 
-		return &book.Asks[0], nil
+		rows = append(rows, []string{
+			t.Market,
+			fmt.Sprintf("%.*f", precision, t.Bid),
+			fmt.Sprintf("%.*f", precision, t.Ask),
+			fmt.Sprintf("%.*f", precision, t.Last),
+			"",
+		})
 	}
 
-	if len(book.Bids) < 1 {
-		return nil, errors.New(ERROR_NO_BIDS)
+	printTable(header, rows)
+}
+
+func printTicker(t gemini.Ticker) {
+	fmt.Fprintf(stdout, "%s:\t%s\n", blue("Bid"), boldWhite(t.Bid))
+	fmt.Fprintf(stdout, "%s:\t%s\n", blue("Ask"), boldWhite(t.Ask))
+	fmt.Fprintf(stdout, "%s:\t%.*f\n", blue("Last"), precision, t.Last)
+	fmt.Fprintf(stdout, "%s:\t%v\n", blue("Volume"), t.Volume.BTC)
+}
+
+// printTopQuote prints quote on a single line. Compared with the previous
+// quote, a wider spread is shown in red and a narrower one in green. In
+// place redraws the line rather than starting a new one.
+func printTopQuote(quote, previous *topQuote, inPlace bool) {
+	spread := fmt.Sprintf("%.*f (%.2f bps)", precision, quote.Spread, quote.SpreadBps)
+
+	if previous != nil && quote.Spread > previous.Spread {
+		spread = red(spread)
+	} else if previous != nil && quote.Spread < previous.Spread {
+		spread = green(spread)
+	}
+
+	line := fmt.Sprintf("%s %.*f  %s %.*f  %s %s  %s %.*f",
+		blue("Bid"), precision, quote.Bid,
+		blue("Ask"), precision, quote.Ask,
+		blue("Spread"), spread,
+		blue("Last"), precision, quote.Last,
+	)
+
+	if inPlace {
+		terminalControl("\r\033[K")
+		fmt.Fprint(stdout, line)
+		return
+	}
+	fmt.Fprintln(stdout, line)
+}
+
+func printTrade(trade gemini.Trade) {
+	w := newTabWriter()
+
+	fmt.Fprintf(w, "%s:\t%s\n", blue("OrderId"), boldWhite(trade.OrderId))
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Timestamp"), formatTimestamp(trade.Timestamp, time.Second))
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Type"), trade.Type)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("Price"), precision, trade.Price)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("Amount"), precision, trade.Amount)
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("FeeAmount"), precision, trade.FeeAmount)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("FeeCurrency"), trade.FeeCurrency)
+	fmt.Fprintf(w, "%s:\t%v\n", blue("Maker"), !trade.Aggressor)
+
+	w.Flush()
+}
+
+// printTradeSummary prints the fees paid in each fee currency, then the
+// volume bought and sold.
+func printTradeSummary(summary tradeSummary) {
+	if quiet {
+		return
+	}
+
+	w := newTabWriter()
+
+	for _, currency := range sortedKeys(summary.Fees) {
+		fmt.Fprintf(w, "%s:\t%.*f %s\n", blue("TotalFees"), precision, summary.Fees[currency], currency)
+	}
+
+	for _, side := range []string{"buy", "sell"} {
+		label := "Bought"
+		if side == "sell" {
+			label = "Sold"
+		}
+
+		v := summary.Volume[side]
+		fmt.Fprintf(w, "%s:\t%.*f for %.*f in %d trades\n", blue(label), precision, v.Amount, precision, v.Notional, v.Trades)
 	}
 
-	return &book.Bids[0], nil
+	w.Flush()
 }
 
-func getTimeFromDate(date string) (int64, error) {
-	t, err := time.Parse("2006-01-02", date)
+func printTradeSummaryCSV(summary tradeSummary, fields string) error {
+	header, rows := tradeSummaryTable(summary)
+
+	header, rows, err := selectColumns(header, rows, fields)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	return t.UnixNano() / int64(time.Millisecond), nil
+	return writeCSV(header, rows)
 }
 
-func printError(err error) {
-	fmt.Fprintf(os.Stderr, "%s: %v\n", red("Error"), err)
-	fmt.Fprintf(os.Stderr, "")
-	return
+func printTradeSummaryTable(summary tradeSummary, fields string) error {
+	header, rows := tradeSummaryTable(summary)
+
+	header, rows, err := selectColumns(header, rows, fields)
+	if err != nil {
+		return err
+	}
+
+	printTable(header, rows)
+	return nil
 }
 
-func printOrder(order gemini.Order) {
-	fmt.Printf("%s:\t\t%s\n", blue("OrderId"), boldWhite(order.OrderId))
-	fmt.Printf("%s:\t\t\t%s\n", blue("Symbol"), order.Symbol)
-	fmt.Printf("%s:\t\t\t%s\n", blue("Side"), order.Side)
-	fmt.Printf("%s:\t\t\t%.8f\n", blue("Price"), order.Price)
-	fmt.Printf("%s:\t\t%.8f\n", blue("OriginalAmount"), order.OriginalAmount)
-	fmt.Printf("%s:\t\t%.8f\n", blue("ExecutedAmount"), order.ExecutedAmount)
-	fmt.Printf("%s:\t%.8f\n", blue("RemainingAmount"), order.RemainingAmount)
-	fmt.Printf("%s:\t%.8f\n", blue("AvgExecutionPrice"), order.AvgExecutionPrice)
-	fmt.Printf("%s:\t\t\t%v\n", blue("IsLive"), order.IsLive)
-	fmt.Printf("%s:\t\t%v\n", blue("IsCancelled"), order.IsCancelled)
+func printTradesCSV(trades []gemini.Trade, fields string) error {
+	header, rows := tradeTable(trades)
+
+	header, rows, err := selectColumns(header, rows, fields)
+	if err != nil {
+		return err
+	}
+
+	return writeCSV(header, rows)
 }
 
-func printTrade(trade gemini.Trade) {
-	fmt.Printf("%s:\t%s\n", blue("OrderId"), boldWhite(trade.OrderId))
-	fmt.Printf("%s:\t%v\n", blue("Timestamp"), trade.Timestamp)
-	fmt.Printf("%s:\t\t%s\n", blue("Type"), trade.Type)
-	fmt.Printf("%s:\t\t%.8f\n", blue("Price"), trade.Price)
-	fmt.Printf("%s:\t\t%.8f\n", blue("Amount"), trade.Amount)
-	fmt.Printf("%s:\t%.8f\n", blue("FeeAmount"), trade.FeeAmount)
-	fmt.Printf("%s:\t\t%v\n", blue("Maker"), !trade.Aggressor)
+func printTradesTable(trades []gemini.Trade, fields string) error {
+	header, rows := tradeTable(trades)
+
+	header, rows, err := selectColumns(header, rows, fields)
+	if err != nil {
+		return err
+	}
+
+	printTable(header, rows)
+	return nil
+}
+
+func printTransfer(t transfer) {
+	w := newTabWriter()
+
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Eid"), boldWhite(strconv.FormatInt(t.Eid, 10)))
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Timestamp"), formatTimestamp(t.TimestampMS, time.Millisecond))
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Type"), t.Type)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Currency"), strings.ToUpper(t.Currency))
+	fmt.Fprintf(w, "%s:\t%.*f\n", blue("Amount"), precision, t.Amount)
+	fmt.Fprintf(w, "%s:\t%s\n", blue("Status"), t.Status)
+	if t.TxHash != "" {
+		fmt.Fprintf(w, "%s:\t%s\n", blue("TxHash"), t.TxHash)
+	}
+	if t.Destination != "" {
+		fmt.Fprintf(w, "%s:\t%s\n", blue("Destination"), t.Destination)
+	}
+
+	w.Flush()
+}
+
+func printTransfersCSV(transfers []transfer, fields string) error {
+	header, rows := transferTable(transfers)
+
+	header, rows, err := selectColumns(header, rows, fields)
+	if err != nil {
+		return err
+	}
+
+	return writeCSV(header, rows)
+}
+
+func printTransfersTable(transfers []transfer, fields string) error {
+	header, rows := transferTable(transfers)
+
+	header, rows, err := selectColumns(header, rows, fields)
+	if err != nil {
+		return err
+	}
+
+	printTable(header, rows)
+	return nil
+}
+
+// readLine reads a line from stdin, giving up when requests are cancelled.
+// One reader goroutine is shared by every caller, so a line typed after an
+// interrupt goes to the next prompt instead of a reader that was abandoned.
+func readLine() (string, error) {
+	stdinOnce.Do(func() {
+		stdinLines = make(chan stdinLine)
+
+		go func() {
+			r := bufio.NewReader(os.Stdin)
+			for {
+				text, err := r.ReadString('\n')
+				stdinLines <- stdinLine{text, err}
+				if err != nil {
+					close(stdinLines)
+					return
+				}
+			}
+		}()
+	})
+
+	select {
+	case line, ok := <-stdinLines:
+		if !ok {
+			return "", io.EOF
+		}
+		return line.text, line.err
+	case <-requestCtx.Done():
+		return "", errors.New(ERROR_INTERRUPTED)
+	}
+}
+
+// replaceOrder cancels order and places it again for amount at price with
+// its original market, side and options. A zero amount keeps whatever was
+// left unfilled once the cancel went through, since part of the order may
+// have filled in the meantime. The cancelled order is returned along with
+// the new one.
+func replaceOrder(ex exchange, order gemini.Order, clientOrderId string, amount, price float64) (gemini.Order, gemini.Order, error) {
+	cancelled, err := ex.CancelOrder(order.OrderId)
+	if err != nil {
+		return gemini.Order{}, gemini.Order{}, err
+	}
+
+	if amount <= 0 {
+		amount, err = getLimitAmount(order.Symbol, order.Side, 0, cancelled.RemainingAmount, price, 0)
+		if err != nil {
+			return gemini.Order{}, cancelled, fmt.Errorf("%s: %v", ERROR_REPLACE_FAILED, err)
+		}
+	}
+
+	newOrder, err := ex.NewOrder(order.Symbol, clientOrderId, amount, price, order.Side, order.Options)
+	if err != nil {
+		return gemini.Order{}, cancelled, fmt.Errorf("%s: %v", ERROR_REPLACE_FAILED, err)
+	}
+
+	return newOrder, cancelled, nil
 }
 
 func round(v float64, decimals int) float64 {
-	var pow float64 = 1
-	for i := 0; i < decimals; i++ {
-		pow *= 10
+	pow := math.Pow(10, float64(decimals))
+	return math.Round(v*pow) / pow
+}
+
+// roundToIncrement rounds v to the nearest multiple of increment. The
+// extra decimal covers increments such as 0.05 that aren't a power of ten.
+func roundToIncrement(v, increment float64) float64 {
+	if increment <= 0 {
+		return v
+	}
+	return round(math.Round(v/increment)*increment, getDecimals(increment)+1)
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// sortOrders sorts orders in place by one of ORDER_SORT_FIELDS. Amount is
+// the amount still resting on the book. An empty field keeps the order the
+// exchange returned.
+func sortOrders(orders []gemini.Order, field string, desc bool) error {
+	var less func(a, b gemini.Order) bool
+
+	switch field {
+	case "":
+		return nil
+	case "price":
+		less = func(a, b gemini.Order) bool { return a.Price < b.Price }
+	case "amount":
+		less = func(a, b gemini.Order) bool { return a.RemainingAmount < b.RemainingAmount }
+	case "timestamp":
+		less = func(a, b gemini.Order) bool { return a.Timestamp < b.Timestamp }
+	default:
+		return fmt.Errorf("%s: %s", ERROR_INVALID_SORT, strings.Join(ORDER_SORT_FIELDS, ", "))
+	}
+
+	sort.SliceStable(orders, func(i, j int) bool {
+		if desc {
+			return less(orders[j], orders[i])
+		}
+		return less(orders[i], orders[j])
+	})
+
+	return nil
+}
+
+// splitAmount divides total into n parts rounded down to decimals, with the
+// last part taking up the remainder so that the parts add up to total.
+func splitAmount(total float64, n int, decimals int) []float64 {
+	parts := make([]float64, n)
+
+	part := floor(total/float64(n), decimals)
+	for i := range parts {
+		parts[i] = part
+	}
+	parts[n-1] = round(total-part*float64(n-1), decimals)
+
+	return parts
+}
+
+// summarizeMarketTrades totals the public trades of mkt since from.
+func summarizeMarketTrades(mkt string, from int64, trades []marketTrade) tradeStats {
+	stats := tradeStats{Market: mkt, From: from, Count: len(trades)}
+
+	if len(trades) == 0 {
+		return stats
+	}
+
+	stats.MinPrice = trades[0].Price
+	stats.MaxPrice = trades[0].Price
+
+	total := 0.0
+	notional := 0.0
+
+	for _, t := range trades {
+		stats.MinPrice = math.Min(stats.MinPrice, t.Price)
+		stats.MaxPrice = math.Max(stats.MaxPrice, t.Price)
+		stats.Volume += t.Amount
+
+		if t.Type == "buy" {
+			stats.BuyVolume += t.Amount
+		} else {
+			stats.SellVolume += t.Amount
+		}
+
+		total += t.Price
+		notional += t.Price * t.Amount
+	}
+
+	stats.AvgPrice = total / float64(len(trades))
+	if stats.Volume > 0 {
+		stats.Vwap = notional / stats.Volume
+	}
+
+	return stats
+}
+
+// summarizeFills totals what a series of orders executed.
+func summarizeFills(orders []gemini.Order) fillSummary {
+	summary := fillSummary{Orders: len(orders)}
+
+	for _, order := range orders {
+		summary.BaseAmount += order.ExecutedAmount
+		summary.QuoteAmount += order.ExecutedAmount * order.AvgExecutionPrice
+	}
+
+	if summary.BaseAmount > 0 {
+		summary.AvgPrice = summary.QuoteAmount / summary.BaseAmount
+	}
+
+	return summary
+}
+
+// summarizeTrades totals the fees of trades by fee currency and their
+// volume by side.
+func summarizeTrades(trades []gemini.Trade) tradeSummary {
+	summary := tradeSummary{
+		Trades: len(trades),
+		Fees:   map[string]float64{},
+		Volume: map[string]sideVolume{},
+	}
+
+	for _, trade := range trades {
+		summary.Fees[strings.ToUpper(trade.FeeCurrency)] += trade.FeeAmount
+
+		side := strings.ToLower(trade.Type)
+		v := summary.Volume[side]
+		v.Trades++
+		v.Amount += trade.Amount
+		v.Notional += trade.Amount * trade.Price
+		summary.Volume[side] = v
+	}
+
+	return summary
+}
+
+// selectColumns narrows header and rows to the comma separated fields, in
+// the order given. Names match the header case-insensitively and an empty
+// fields keeps every column.
+func selectColumns(header []string, rows [][]string, fields string) ([]string, [][]string, error) {
+	if fields == "" {
+		return header, rows, nil
+	}
+
+	var cols []int
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+
+		col := -1
+		for i, name := range header {
+			if strings.EqualFold(name, field) {
+				col = i
+				break
+			}
+		}
+		if col < 0 {
+			return nil, nil, fmt.Errorf("%s: %s", ERROR_INVALID_COLUMN, strings.Join(header, ", "))
+		}
+
+		cols = append(cols, col)
+	}
+
+	selected := make([]string, len(cols))
+	for i, col := range cols {
+		selected[i] = header[col]
+	}
+
+	selectedRows := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		r := make([]string, len(cols))
+		for i, col := range cols {
+			r[i] = row[col]
+		}
+		selectedRows = append(selectedRows, r)
+	}
+
+	return selected, selectedRows, nil
+}
+
+// sendHeartbeat tells the exchange the session is still alive. The local
+// time is recorded since the response doesn't carry one.
+func sendHeartbeat() (*heartbeatResult, error) {
+	res := &heartbeatResult{}
+	err := withRetry(func() error {
+		return privateRequest("/v1/heartbeat", nil, res)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res.Timestamp = time.Now().UnixNano() / int64(time.Millisecond)
+	return res, nil
+}
+
+// startHeartbeat sends a heartbeat every HEARTBEAT_INTERVAL in the
+// background until the returned func is called. A failed heartbeat is only
+// logged; the exchange cancels the session's orders if they keep failing.
+func startHeartbeat(enabled bool) func() {
+	if !enabled {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		tick := time.NewTicker(HEARTBEAT_INTERVAL)
+		defer tick.Stop()
+
+		for {
+			if _, err := sendHeartbeat(); err != nil {
+				slog.Warn("Heartbeat failed", "error", err)
+			} else {
+				slog.Debug("Sent heartbeat")
+			}
+
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// sleep waits for d, returning early with an error when interrupted.
+func sleep(d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-requestCtx.Done():
+		return errors.New(ERROR_INTERRUPTED)
+	}
+}
+
+// terminalControl writes an escape sequence to stdout, dropping it when
+// stdout is a file or pipe so that those get plain output.
+func terminalControl(code string) {
+	if isTerminalOutput() {
+		fmt.Fprint(stdout, code)
+	}
+}
+
+// trailTrigger returns the price that triggers a trailing stop on side
+// that has seen peak: below it for a sell, above it for a buy.
+func trailTrigger(side string, peak, distance float64, pct bool) float64 {
+	if pct {
+		distance = peak * distance / 100
+	}
+
+	if side == "buy" {
+		return peak + distance
+	}
+	return peak - distance
+}
+
+func tradeTable(trades []gemini.Trade) ([]string, [][]string) {
+	header := []string{
+		"OrderId",
+		"Timestamp",
+		"Type",
+		"Price",
+		"Amount",
+		"FeeAmount",
+		"FeeCurrency",
+		"Maker",
+	}
+
+	rows := make([][]string, 0, len(trades))
+	for _, trade := range trades {
+		rows = append(rows, []string{
+			fmt.Sprintf("%v", trade.OrderId),
+			formatTimestamp(trade.Timestamp, time.Second),
+			trade.Type,
+			fmt.Sprintf("%.*f", precision, trade.Price),
+			fmt.Sprintf("%.*f", precision, trade.Amount),
+			fmt.Sprintf("%.*f", precision, trade.FeeAmount),
+			trade.FeeCurrency,
+			strconv.FormatBool(!trade.Aggressor),
+		})
+	}
+
+	return header, rows
+}
+
+// tradeSummaryTable lays a trade summary out as rows, fees first, one per
+// fee currency, then the volume on each side.
+func tradeSummaryTable(summary tradeSummary) ([]string, [][]string) {
+	header := []string{"Total", "Key", "Trades", "Amount", "Notional"}
+
+	rows := make([][]string, 0, len(summary.Fees)+len(summary.Volume))
+	for _, currency := range sortedKeys(summary.Fees) {
+		rows = append(rows, []string{
+			"fees",
+			currency,
+			"",
+			fmt.Sprintf("%.*f", precision, summary.Fees[currency]),
+			"",
+		})
+	}
+
+	for _, side := range []string{"buy", "sell"} {
+		v := summary.Volume[side]
+		rows = append(rows, []string{
+			"volume",
+			side,
+			strconv.Itoa(v.Trades),
+			fmt.Sprintf("%.*f", precision, v.Amount),
+			fmt.Sprintf("%.*f", precision, v.Notional),
+		})
+	}
+
+	return header, rows
+}
+
+func transferTable(transfers []transfer) ([]string, [][]string) {
+	header := []string{
+		"Eid",
+		"Timestamp",
+		"Type",
+		"Currency",
+		"Amount",
+		"Status",
+		"TxHash",
+	}
+
+	rows := make([][]string, 0, len(transfers))
+	for _, t := range transfers {
+		rows = append(rows, []string{
+			strconv.FormatInt(t.Eid, 10),
+			formatTimestamp(t.TimestampMS, time.Millisecond),
+			t.Type,
+			strings.ToUpper(t.Currency),
+			fmt.Sprintf("%.*f", precision, t.Amount),
+			t.Status,
+			t.TxHash,
+		})
+	}
+
+	return header, rows
+}
+
+func writeCSV(header []string, rows [][]string) error {
+	w := csv.NewWriter(stdout)
+
+	w.Write(header)
+	w.WriteAll(rows)
+
+	return w.Error()
+}
+
+// waitForOrder polls the status of order every interval until it's no
+// longer live. With a timeout, it gives up once that has passed, printing
+// the last status it saw.
+func waitForOrder(c *cli.Context, ex exchange, order gemini.Order) (gemini.Order, error) {
+	interval := c.Int("interval")
+	if interval <= 0 {
+		return order, errors.New(ERROR_INVALID_INTERVAL)
+	}
+
+	var deadline time.Time
+	if c.Duration("timeout") > 0 {
+		deadline = time.Now().Add(c.Duration("timeout"))
+	}
+
+	for order.IsLive {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			if jsonOutput(c) {
+				printJSON(order)
+			} else {
+				printOrder(order)
+			}
+			return order, errors.New(ERROR_WAIT_TIMEOUT)
+		}
+
+		err := sleep(time.Duration(interval) * time.Second)
+		if err != nil {
+			return order, err
+		}
+
+		err = withRetry(func() (err error) {
+			order, err = ex.OrderStatus(order.OrderId)
+			return err
+		})
+		if err != nil {
+			return order, err
+		}
+	}
+
+	return order, nil
+}
+
+// walkBook fills amount of quote currency, or baseAmount when amount is
+// 0, against entries in order and reports the resulting prices. Any part
+// the book is too thin to fill is returned as the shortfall in the same
+// currency that was asked for.
+func walkBook(entries []gemini.BookEntry, amount, baseAmount float64) bookFill {
+	fill := bookFill{}
+
+	remaining := baseAmount
+	if amount > 0 {
+		remaining = amount
+	}
+
+	for _, entry := range entries {
+		if remaining <= 0 {
+			break
+		}
+
+		base := math.Min(entry.Amount, remaining)
+		if amount > 0 {
+			base = math.Min(entry.Amount, remaining/entry.Price)
+			remaining -= base * entry.Price
+		} else {
+			remaining -= base
+		}
+
+		if fill.Levels == 0 {
+			fill.BestPrice = entry.Price
+		}
+
+		fill.BaseAmount += base
+		fill.QuoteAmount += base * entry.Price
+		fill.WorstPrice = entry.Price
+		fill.Levels++
+	}
+
+	if fill.BaseAmount > 0 {
+		fill.AvgPrice = fill.QuoteAmount / fill.BaseAmount
+		fill.SlippageBps = math.Abs(fill.AvgPrice-fill.BestPrice) / fill.BestPrice * 10000
+	}
+
+	if remaining > 0 {
+		fill.Shortfall = remaining
+	}
+
+	return fill
+}
+
+// withRetry calls fn until it succeeds, returns an error that isn't
+// transient, or maxRetries is reached. Attempts back off exponentially
+// with jitter unless the server asked for a specific delay.
+func withRetry(fn func() error) error {
+	delay := RETRY_BASE_DELAY
+
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= maxRetries || !isRetryable(err) {
+			return err
+		}
+
+		wait := delay + time.Duration(rand.Int63n(int64(delay)))
+
+		var re *retryableError
+		if errors.As(err, &re) && re.retryAfter > 0 {
+			wait = re.retryAfter
+		}
+
+		slog.Debug("Retrying request", "attempt", attempt+1, "error", err, "delay", wait)
+
+		if err := sleep(wait); err != nil {
+			return err
+		}
+		delay *= 2
 	}
-	return float64(int((v*pow)+0.5)) / pow
 }
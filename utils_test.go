@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"math"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/jsgoyette/gemini"
+)
+
+// setLocal makes name the local zone for the rest of the test.
+func setLocal(t *testing.T, name string) {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := time.Local
+	time.Local = loc
+	t.Cleanup(func() { time.Local = local })
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		v        float64
+		decimals int
+		want     float64
+	}{
+		{2.5, 0, 3},
+		{3.49, 0, 3},
+		{-2.5, 0, -3},
+		{0.125, 2, 0.13},
+		{-0.125, 2, -0.13},
+		{-1.2345, 3, -1.235},
+		{0.0000000149, 8, 0.00000001},
+		{123456789012.345678, 2, 123456789012.35},
+		{1e20, 2, 1e20},
+		{-1e20, 2, -1e20},
+		{0, 8, 0},
+	}
+
+	for _, tt := range tests {
+		got := round(tt.v, tt.decimals)
+		if got != tt.want {
+			t.Errorf("round(%v, %d) = %v, want %v", tt.v, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestRoundToIncrement(t *testing.T) {
+	tests := []struct {
+		v         float64
+		increment float64
+		want      float64
+	}{
+		{101.234, 0.01, 101.23},
+		{101.236, 0.01, 101.24},
+		{-1.234, 0.01, -1.23},
+		{0.123, 0.05, 0.1},
+		{0.13, 0.05, 0.15},
+		{102.5, 5, 105},
+		{0.00012345, 0.00001, 0.00012},
+		{5.5, 0, 5.5},
+	}
+
+	for _, tt := range tests {
+		got := roundToIncrement(tt.v, tt.increment)
+		if got != tt.want {
+			t.Errorf("roundToIncrement(%v, %v) = %v, want %v", tt.v, tt.increment, got, tt.want)
+		}
+	}
+}
+
+func TestFloorToIncrement(t *testing.T) {
+	tests := []struct {
+		v         float64
+		increment float64
+		want      float64
+	}{
+		{101.239, 0.01, 101.23},
+		{0.3, 0.1, 0.3},
+		{0.149, 0.05, 0.1},
+		{0.15, 0.05, 0.15},
+		{104.9, 5, 100},
+		{0.00012999, 0.00001, 0.00012},
+		{7, 0, 7},
+	}
+
+	for _, tt := range tests {
+		got := floorToIncrement(tt.v, tt.increment)
+		if got != tt.want {
+			t.Errorf("floorToIncrement(%v, %v) = %v, want %v", tt.v, tt.increment, got, tt.want)
+		}
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	setLocal(t, "America/New_York")
+	t.Cleanup(func() { timeUTC, timeEpoch = false, false })
+
+	// either side of the 2026 spring forward and fall back in New York
+	springBefore := time.Date(2026, 3, 8, 6, 59, 59, 0, time.UTC)
+	springAfter := time.Date(2026, 3, 8, 7, 0, 0, 0, time.UTC)
+	fallBefore := time.Date(2026, 11, 1, 5, 59, 59, 0, time.UTC)
+	fallAfter := time.Date(2026, 11, 1, 6, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		utc   bool
+		epoch bool
+		raw   int64
+		unit  time.Duration
+		want  string
+	}{
+		{"before spring forward", false, false, springBefore.Unix(), time.Second, "2026-03-08T01:59:59-05:00"},
+		{"after spring forward", false, false, springAfter.Unix(), time.Second, "2026-03-08T03:00:00-04:00"},
+		{"before fall back", false, false, fallBefore.Unix(), time.Second, "2026-11-01T01:59:59-04:00"},
+		{"after fall back", false, false, fallAfter.Unix(), time.Second, "2026-11-01T01:00:00-05:00"},
+		{"milliseconds", false, false, springAfter.UnixMilli(), time.Millisecond, "2026-03-08T03:00:00-04:00"},
+		{"utc", true, false, springBefore.Unix(), time.Second, "2026-03-08T06:59:59Z"},
+		{"utc milliseconds", true, false, fallAfter.UnixMilli(), time.Millisecond, "2026-11-01T06:00:00Z"},
+		{"epoch", false, true, springAfter.Unix(), time.Second, "1772953200"},
+		{"epoch over utc", true, true, fallAfter.UnixMilli(), time.Millisecond, "1793512800000"},
+	}
+
+	for _, tt := range tests {
+		timeUTC, timeEpoch = tt.utc, tt.epoch
+		got := formatTimestamp(tt.raw, tt.unit)
+		if got != tt.want {
+			t.Errorf("%s: formatTimestamp(%d, %v) = %q, want %q", tt.name, tt.raw, tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestGetTimeFromDate(t *testing.T) {
+	setLocal(t, "Europe/London")
+
+	tests := []struct {
+		date string
+		tz   string
+		want time.Time
+	}{
+		{"2026-03-08", "America/New_York", time.Date(2026, 3, 8, 5, 0, 0, 0, time.UTC)},
+		{"2026-03-09", "America/New_York", time.Date(2026, 3, 9, 4, 0, 0, 0, time.UTC)},
+		{"2026-11-01", "America/New_York", time.Date(2026, 11, 1, 4, 0, 0, 0, time.UTC)},
+		{"2026-11-02", "America/New_York", time.Date(2026, 11, 2, 5, 0, 0, 0, time.UTC)},
+		{"2026-03-29", "UTC", time.Date(2026, 3, 29, 0, 0, 0, 0, time.UTC)},
+		{"2026-03-29", "", time.Date(2026, 3, 29, 0, 0, 0, 0, time.UTC)},
+		{"2026-03-30", "", time.Date(2026, 3, 29, 23, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		got, err := getTimeFromDate(tt.date, tt.tz)
+		if err != nil {
+			t.Errorf("getTimeFromDate(%q, %q): %v", tt.date, tt.tz, err)
+			continue
+		}
+		if got != tt.want.UnixMilli() {
+			t.Errorf("getTimeFromDate(%q, %q) = %d, want %d", tt.date, tt.tz, got, tt.want.UnixMilli())
+		}
+	}
+
+	_, err := getTimeFromDate("2026-03-08", "Nowhere/Place")
+	if err == nil {
+		t.Error("getTimeFromDate with an unknown zone: want an error")
+	}
+}
+
+func TestGetDateRangeAcrossDST(t *testing.T) {
+	// the spring forward day is 23 hours long and the fall back day 25
+	tests := []struct {
+		date string
+		want time.Duration
+	}{
+		{"2026-03-08", 23 * time.Hour},
+		{"2026-03-09", 24 * time.Hour},
+		{"2026-11-01", 25 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		start, end, err := getDateRange(tt.date, tt.date, "America/New_York")
+		if err != nil {
+			t.Errorf("getDateRange(%q): %v", tt.date, err)
+			continue
+		}
+		got := time.Duration(end-start) * time.Millisecond
+		if got != tt.want {
+			t.Errorf("getDateRange(%q) spans %v, want %v", tt.date, got, tt.want)
+		}
+	}
+}
+
+func TestWalkBook(t *testing.T) {
+	asks := []gemini.BookEntry{{Price: 100, Amount: 1}, {Price: 101, Amount: 2}}
+	bids := []gemini.BookEntry{{Price: 99, Amount: 1}, {Price: 98, Amount: 1}}
+
+	tests := []struct {
+		name       string
+		entries    []gemini.BookEntry
+		amount     float64
+		baseAmount float64
+		want       bookFill
+	}{
+		{"one level", asks, 0, 0.5, bookFill{BaseAmount: 0.5, QuoteAmount: 50, AvgPrice: 100, BestPrice: 100, WorstPrice: 100, Levels: 1}},
+		{"two levels", asks, 0, 2, bookFill{BaseAmount: 2, QuoteAmount: 201, AvgPrice: 100.5, BestPrice: 100, WorstPrice: 101, SlippageBps: 50, Levels: 2}},
+		{"base shortfall", asks, 0, 5, bookFill{BaseAmount: 3, QuoteAmount: 302, AvgPrice: 302.0 / 3, BestPrice: 100, WorstPrice: 101, SlippageBps: 200.0 / 3, Levels: 2, Shortfall: 2}},
+		{"quote amount", asks, 150, 0, bookFill{BaseAmount: 1 + 50.0/101, QuoteAmount: 150, AvgPrice: 150 / (1 + 50.0/101), BestPrice: 100, WorstPrice: 101, SlippageBps: (150/(1+50.0/101) - 100) / 100 * 10000, Levels: 2}},
+		{"quote shortfall", asks, 500, 0, bookFill{BaseAmount: 3, QuoteAmount: 302, AvgPrice: 302.0 / 3, BestPrice: 100, WorstPrice: 101, SlippageBps: 200.0 / 3, Levels: 2, Shortfall: 198}},
+		{"quote over base", asks, 50, 2, bookFill{BaseAmount: 0.5, QuoteAmount: 50, AvgPrice: 100, BestPrice: 100, WorstPrice: 100, Levels: 1}},
+		{"sell side", bids, 0, 2, bookFill{BaseAmount: 2, QuoteAmount: 197, AvgPrice: 98.5, BestPrice: 99, WorstPrice: 98, SlippageBps: 0.5 / 99 * 10000, Levels: 2}},
+		{"empty book", nil, 0, 1, bookFill{Shortfall: 1}},
+	}
+
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+	for _, tt := range tests {
+		got := walkBook(tt.entries, tt.amount, tt.baseAmount)
+		if !near(got.BaseAmount, tt.want.BaseAmount) ||
+			!near(got.QuoteAmount, tt.want.QuoteAmount) ||
+			!near(got.AvgPrice, tt.want.AvgPrice) ||
+			got.BestPrice != tt.want.BestPrice ||
+			got.WorstPrice != tt.want.WorstPrice ||
+			!near(got.SlippageBps, tt.want.SlippageBps) ||
+			got.Levels != tt.want.Levels ||
+			!near(got.Shortfall, tt.want.Shortfall) {
+			t.Errorf("%s: walkBook = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFillMarketOrder(t *testing.T) {
+	stubSymbolDetails(t, &symbolDetails{
+		Symbol:         "btcusd",
+		BaseCurrency:   "btc",
+		QuoteCurrency:  "usd",
+		TickSize:       1e-8,
+		QuoteIncrement: 0.01,
+		MinOrderSize:   0.00001,
+	})
+
+	book := func() gemini.Book {
+		return gemini.Book{
+			Bids: []gemini.BookEntry{{Price: 100, Amount: 2}, {Price: 99, Amount: 2}, {Price: 98, Amount: 10}},
+			Asks: []gemini.BookEntry{{Price: 100, Amount: 3}, {Price: 101, Amount: 4}, {Price: 102, Amount: 100}},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		side         string
+		amount       float64
+		baseAmount   float64
+		unsafe       bool
+		requoteLimit int
+		wantOrders   int
+		wantErr      error
+	}{
+		// 1000 usd takes 3 @ 100, 4 @ 101 and the rest @ 102
+		{"quote amount", "buy", 1000, 0, true, REQUOTES_MAX, 3, nil},
+		{"base amount", "sell", 0, 5, true, REQUOTES_MAX, 3, nil},
+		{"safe stops after one order", "buy", 1000, 0, false, REQUOTES_MAX, 1, nil},
+		{"requote limit", "buy", 1000, 0, true, 2, 2, errors.New(ERROR_MAX_REQUOTES)},
+		{"below the minimum", "sell", 0, 0.000001, true, REQUOTES_MAX, 0, errors.New(ERROR_BELOW_MIN_ORDER + ": 1e-05")},
+	}
+
+	for _, tt := range tests {
+		ex := &fakeExchange{book: book()}
+
+		executedBase, executedQuote := 0.0, 0.0
+		handled := 0
+
+		err := fillMarketOrder(ex, "btcusd", tt.side, "client-id", "immediate-or-cancel", tt.amount, tt.baseAmount, tt.unsafe, tt.requoteLimit, nil, func(order gemini.Order) {
+			handled++
+			executedBase += order.ExecutedAmount
+			executedQuote += order.ExecutedAmount * order.AvgExecutionPrice
+
+			if order.ClientOrderId != "client-id" || order.Options[0] != "immediate-or-cancel" {
+				t.Errorf("%s: order sent with %q and %v", tt.name, order.ClientOrderId, order.Options)
+			}
+		})
+
+		if (err == nil) != (tt.wantErr == nil) || (err != nil && err.Error() != tt.wantErr.Error()) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if len(ex.orders) != tt.wantOrders || handled != tt.wantOrders {
+			t.Errorf("%s: sent %d orders and handled %d, want %d", tt.name, len(ex.orders), handled, tt.wantOrders)
+		}
+		if tt.wantErr != nil || !tt.unsafe {
+			continue
+		}
+
+		// converged on the target without going over it
+		if tt.amount > 0 && (executedQuote > tt.amount || tt.amount-executedQuote > 0.01) {
+			t.Errorf("%s: executed %v of %v quote", tt.name, executedQuote, tt.amount)
+		}
+		if tt.baseAmount > 0 && math.Abs(executedBase-tt.baseAmount) > 0.00001 {
+			t.Errorf("%s: executed %v of %v base", tt.name, executedBase, tt.baseAmount)
+		}
+	}
+}
+
+// captureLogs sends slog records to a buffer for the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(logger) })
+
+	return &buf
+}
+
+var incrementDetails = []*symbolDetails{
+	{Symbol: "btcusd", BaseCurrency: "btc", QuoteCurrency: "usd", TickSize: 1e-8, QuoteIncrement: 0.01, MinOrderSize: 0.00001},
+	{Symbol: "ethbtc", BaseCurrency: "eth", QuoteCurrency: "btc", TickSize: 0.001, QuoteIncrement: 0.00001, MinOrderSize: 0.01},
+}
+
+func TestGetLimitAmount(t *testing.T) {
+	stubSymbolDetails(t, incrementDetails...)
+	logs := captureLogs(t)
+
+	tests := []struct {
+		mkt        string
+		side       string
+		amount     float64
+		baseAmount float64
+		price      float64
+		bps        int
+		want       float64
+		wantErr    string
+	}{
+		{"btcusd", "buy", 0, 0.123456789, 64250, 0, 0.12345679, ""},
+		{"ethbtc", "buy", 0, 1.23456, 0.07, 0, 1.235, ""},
+		{"ethbtc", "sell", 0, 1.2344, 0.07, 0, 1.234, ""},
+		{"ethbtc", "buy", 0, 2.5, 0.07, 0, 2.5, ""},
+		{"ethbtc", "buy", 10, 0, 0.05, 0, 200, ""},
+		{"ethbtc", "buy", 100, 0, 0.07, 100, 1414.286, ""},
+		{"ethbtc", "sell", 100, 0, 0.07, 100, 1442.857, ""},
+		{"ethbtc", "buy", 0, 0.004, 0.07, 0, 0, ERROR_BELOW_MIN_ORDER + ": 0.01"},
+		{"ethbtc", "buy", 0, 0.0004, 0.07, 0, 0, ERROR_BELOW_MIN_ORDER + ": 0.01"},
+	}
+
+	for _, tt := range tests {
+		logs.Reset()
+
+		got, err := getLimitAmount(tt.mkt, tt.side, tt.amount, tt.baseAmount, tt.price, tt.bps)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("getLimitAmount(%s, %v, %v): err = %v, want %s", tt.mkt, tt.amount, tt.baseAmount, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("getLimitAmount(%s, %v, %v) = %v, %v, want %v", tt.mkt, tt.amount, tt.baseAmount, got, err, tt.want)
+		}
+
+		// only a base amount that had to be rounded is warned about
+		warned := strings.Contains(logs.String(), "Rounded amount to the quantity increment")
+		if warned != (tt.amount == 0 && got != tt.baseAmount) {
+			t.Errorf("getLimitAmount(%s, %v, %v): warned %v, logs %q", tt.mkt, tt.amount, tt.baseAmount, warned, logs)
+		}
+	}
+}
+
+func TestGetLimitPrice(t *testing.T) {
+	stubSymbolDetails(t, incrementDetails...)
+	logs := captureLogs(t)
+
+	tests := []struct {
+		mkt     string
+		price   float64
+		strict  bool
+		want    float64
+		wantErr string
+	}{
+		{"btcusd", 64250.5, false, 64250.5, ""},
+		{"btcusd", 64250.5, true, 64250.5, ""},
+		{"btcusd", 64250.123, false, 64250.12, ""},
+		{"btcusd", 64250.126, false, 64250.13, ""},
+		{"btcusd", 64250.123, true, 0, ERROR_PRICE_INCREMENT + ": 0.01"},
+		{"ethbtc", 0.07123, true, 0.07123, ""},
+		{"ethbtc", 0.0712345, false, 0.07123, ""},
+		{"ethbtc", 0.071236, false, 0.07124, ""},
+		{"ethbtc", 0.071236, true, 0, ERROR_PRICE_INCREMENT + ": 1e-05"},
+	}
+
+	for _, tt := range tests {
+		logs.Reset()
+
+		got, err := getLimitPrice(tt.mkt, tt.price, tt.strict)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("getLimitPrice(%s, %v, %v): err = %v, want %s", tt.mkt, tt.price, tt.strict, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("getLimitPrice(%s, %v, %v) = %v, %v, want %v", tt.mkt, tt.price, tt.strict, got, err, tt.want)
+		}
+
+		warned := strings.Contains(logs.String(), "Rounded price to the price increment")
+		if warned != (got != tt.price) {
+			t.Errorf("getLimitPrice(%s, %v, %v): warned %v, logs %q", tt.mkt, tt.price, tt.strict, warned, logs)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/urfave/cli"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X main.buildVersion=1.2.0 -X main.buildCommit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	buildVersion = "0.0.1"
+	buildCommit  = ""
+	buildDate    = ""
+)
+
+type versionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// getVersionInfo returns the build's version. A commit and date not set
+// with -ldflags fall back to the VCS details go build embeds, if any.
+func getVersionInfo() versionInfo {
+	info := versionInfo{
+		Version:   buildVersion,
+		Commit:    buildCommit,
+		Date:      buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.Date == "":
+				info.Date = s.Value
+			}
+		}
+	}
+
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.Date == "" {
+		info.Date = "unknown"
+	}
+
+	return info
+}
+
+// printVersion replaces the default --version output with the commit and
+// build date as well.
+func printVersion(c *cli.Context) {
+	info := getVersionInfo()
+	fmt.Fprintf(c.App.Writer, "%s %s (commit %s, built %s)\n", c.App.Name, info.Version, info.Commit, info.Date)
+}
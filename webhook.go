@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jsgoyette/gemini"
+	"github.com/urfave/cli"
+)
+
+// fillNotification is the payload posted to --webhook when an order fills.
+type fillNotification struct {
+	OrderId       string  `json:"order_id"`
+	ClientOrderId string  `json:"client_order_id"`
+	Symbol        string  `json:"symbol"`
+	Side          string  `json:"side"`
+	FilledAmount  float64 `json:"filled_amount"`
+	AvgPrice      float64 `json:"avg_price"`
+	Live          bool    `json:"live"`
+	TimestampMS   int64   `json:"timestampms"`
+}
+
+// notifyFill posts order to the --webhook URL when any of it has filled.
+// The order went through either way, so a webhook that keeps failing is
+// logged rather than failing the command.
+func notifyFill(c *cli.Context, order gemini.Order) {
+	webhookUrl := c.String("webhook")
+	if webhookUrl == "" || order.ExecutedAmount <= 0 {
+		return
+	}
+
+	addRedaction(c.String("webhook-secret"))
+
+	payload := fillNotification{
+		OrderId:       order.OrderId,
+		ClientOrderId: order.ClientOrderId,
+		Symbol:        order.Symbol,
+		Side:          order.Side,
+		FilledAmount:  order.ExecutedAmount,
+		AvgPrice:      order.AvgExecutionPrice,
+		Live:          gemini_api_live,
+		TimestampMS:   time.Now().UnixNano() / int64(time.Millisecond),
+	}
+
+	err := withRetry(func() error {
+		return postWebhook(webhookUrl, c.String("webhook-secret"), payload)
+	})
+	if err != nil {
+		slog.Warn("Webhook failed", "order_id", order.OrderId, "error", err)
+	}
+}
+
+// postWebhook posts v as JSON to webhookUrl, signed with an HMAC-SHA256 of
+// the body in the X-Webhook-Signature header when secret is set. Network
+// errors, rate limits and server errors are retryable.
+func postWebhook(webhookUrl, secret string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", webhookUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return &retryableError{err, 0}
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("%s", resp.Status)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return &retryableError{err, 0}
+		}
+		return err
+	}
+
+	return nil
+}